@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/database"
+	"github.com/ruskiiamov/gophermart/internal/logger"
+	"github.com/ruskiiamov/gophermart/internal/statement"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+)
+
+func main() {
+	var dbURI, tenantID, from, to, format, outDir string
+
+	flag.StringVar(&dbURI, "d", os.Getenv("DATABASE_URI"), "database URI")
+	flag.StringVar(&tenantID, "tenant", tenant.DefaultID, "tenant id")
+	flag.StringVar(&from, "from", "", "period start, YYYY-MM-DD or RFC3339")
+	flag.StringVar(&to, "to", "", "period end, YYYY-MM-DD (inclusive) or RFC3339")
+	flag.StringVar(&format, "format", statement.FormatCSV, "statement format: csv or json")
+	flag.StringVar(&outDir, "o", ".", "output directory")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	ctx = tenant.NewContext(ctx, tenantID)
+
+	if err := run(ctx, dbURI, from, to, format, outDir); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, dbURI, from, to, format, outDir string) error {
+	start, end, err := statement.ParsePeriod(from, to, time.Now())
+	if err != nil {
+		return err
+	}
+
+	dbConnection, err := database.NewConnection(ctx, dbURI)
+	if err != nil {
+		return fmt.Errorf("db connection error: %w", err)
+	}
+	defer dbConnection.Close()
+
+	err = os.MkdirAll(outDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("output dir error: %w", err)
+	}
+
+	bonusManager := bonus.NewManager(dbConnection, nil)
+
+	var count int
+	err = dbConnection.IterateUsers(ctx, func(userID, login string) error {
+		name := fmt.Sprintf("%s_%s_%s.%s", login, start.Format("20060102"), end.Format("20060102"), format)
+
+		err := writeStatement(ctx, bonusManager, filepath.Join(outDir, name), format, userID, start, end)
+		if err != nil {
+			return fmt.Errorf("user %s statement error: %w", login, err)
+		}
+		count++
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("%d statements written to %s", count, outDir))
+
+	return nil
+}
+
+func writeStatement(
+	ctx context.Context,
+	bonusManager *bonus.Manager,
+	path, format, userID string,
+	from, to time.Time,
+) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sink, err := statement.NewWriter(format, file, userID, from, to)
+	if err != nil {
+		return err
+	}
+
+	err = bonusManager.Statement(ctx, userID, from, to, sink)
+	if err != nil {
+		return err
+	}
+
+	err = sink.Flush()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,141 @@
+package access
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyScheme      = "ApiKey "
+	apiKeyPrefix      = "gm_"
+	apiKeyPrefixBytes = 4
+	apiKeySecretBytes = 32
+)
+
+const (
+	ScopeOrdersRead   = "orders:read"
+	ScopeOrdersWrite  = "orders:write"
+	ScopeBalanceRead  = "balance:read"
+	ScopeBalanceWrite = "balance:write"
+)
+
+var scopes = map[string]struct{}{
+	ScopeOrdersRead:   {},
+	ScopeOrdersWrite:  {},
+	ScopeBalanceRead:  {},
+	ScopeBalanceWrite: {},
+}
+
+var (
+	ErrAPIKeyNotValid = errors.New("wrong api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyName     = errors.New("wrong api key name")
+	ErrAPIKeyScopes   = errors.New("wrong api key scopes")
+)
+
+type APIKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func IsAPIKey(authValue string) bool {
+	return strings.HasPrefix(authValue, apiKeyScheme)
+}
+
+func (a *Manager) CreateAPIKey(ctx context.Context, userID, name string, keyScopes []string) (string, *APIKey, error) {
+	if name == "" || len(name) > 255 {
+		return "", nil, ErrAPIKeyName
+	}
+
+	if len(keyScopes) == 0 {
+		return "", nil, ErrAPIKeyScopes
+	}
+	for _, scope := range keyScopes {
+		if _, ok := scopes[scope]; !ok {
+			return "", nil, ErrAPIKeyScopes
+		}
+	}
+
+	prefix := make([]byte, apiKeyPrefixBytes)
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", nil, fmt.Errorf("api key generation error: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("api key generation error: %w", err)
+	}
+
+	key := &APIKey{
+		UserID: userID,
+		Name:   name,
+		Prefix: apiKeyPrefix + hex.EncodeToString(prefix),
+		Scopes: keyScopes,
+	}
+	plain := key.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	err := a.userProvider.CreateAPIKey(ctx, key, hashAPIKey(plain))
+	if err != nil {
+		return "", nil, fmt.Errorf("create api key error: %w", err)
+	}
+
+	return apiKeyScheme + plain, key, nil
+}
+
+func (a *Manager) GetAPIKeys(ctx context.Context, userID string) ([]*APIKey, error) {
+	keys, err := a.userProvider.GetAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get api keys error: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (a *Manager) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	err := a.userProvider.RevokeAPIKey(ctx, userID, keyID)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("revoke api key error: %w", err)
+	}
+
+	return nil
+}
+
+func (a *Manager) AuthByAPIKey(ctx context.Context, authValue string) (userID string, keyScopes []string, err error) {
+	if !IsAPIKey(authValue) {
+		return "", nil, ErrAPIKeyNotValid
+	}
+
+	plain := authValue[len(apiKeyScheme):]
+	if !strings.HasPrefix(plain, apiKeyPrefix) {
+		return "", nil, ErrAPIKeyNotValid
+	}
+
+	key, err := a.userProvider.UseAPIKey(ctx, hashAPIKey(plain))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return "", nil, ErrAPIKeyNotValid
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("use api key error: %w", err)
+	}
+
+	return key.UserID, key.Scopes, nil
+}
+
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
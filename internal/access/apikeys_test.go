@@ -0,0 +1,121 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	userProvider := new(mockedUserProvider)
+	accessManager := NewManager(userProvider, newTestKeySet(t), bcrypt.MinCost, LockoutPolicy{}, PasswordPolicy{})
+
+	userID := "aaa-bbb-ccc"
+
+	tests := []struct {
+		name   string
+		scopes []string
+		err    error
+	}{
+		{name: "", scopes: []string{ScopeOrdersWrite}, err: ErrAPIKeyName},
+		{name: "partner", scopes: nil, err: ErrAPIKeyScopes},
+		{name: "partner", scopes: []string{ScopeOrdersWrite, "admin"}, err: ErrAPIKeyScopes},
+	}
+	for _, tt := range tests {
+		t.Run("validation", func(t *testing.T) {
+			plain, key, err := accessManager.CreateAPIKey(context.Background(), userID, tt.name, tt.scopes)
+			assert.Empty(t, plain)
+			assert.Nil(t, key)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		var keyHash string
+		userProvider.On("CreateAPIKey", mock.Anything, mock.AnythingOfType("*access.APIKey"), mock.AnythingOfType("string")).
+			Run(func(args mock.Arguments) {
+				keyHash = args.String(2)
+			}).Return(nil).Once()
+
+		plain, key, err := accessManager.CreateAPIKey(context.Background(), userID, "partner", []string{ScopeOrdersWrite})
+		userProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Regexp(t, "^ApiKey gm_[0-9a-f]{8}_[\\w-]+$", plain)
+		assert.Equal(t, userID, key.UserID)
+		assert.Equal(t, []string{ScopeOrdersWrite}, key.Scopes)
+		assert.Equal(t, hashAPIKey(plain[len(apiKeyScheme):]), keyHash)
+		assert.NotContains(t, keyHash, key.Prefix)
+	})
+}
+
+func TestAuthByAPIKey(t *testing.T) {
+	userProvider := new(mockedUserProvider)
+	accessManager := NewManager(userProvider, newTestKeySet(t), bcrypt.MinCost, LockoutPolicy{}, PasswordPolicy{})
+
+	plain := "gm_0a1b2c3d_c2VjcmV0"
+
+	t.Run("wrong scheme", func(t *testing.T) {
+		userID, _, err := accessManager.AuthByAPIKey(context.Background(), "Bearer "+plain)
+		assert.Empty(t, userID)
+		assert.ErrorIs(t, err, ErrAPIKeyNotValid)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var key *APIKey
+		userProvider.On("UseAPIKey", mock.Anything, hashAPIKey(plain)).Return(key, ErrAPIKeyNotFound).Once()
+
+		userID, _, err := accessManager.AuthByAPIKey(context.Background(), apiKeyScheme+plain)
+		userProvider.AssertExpectations(t)
+
+		assert.Empty(t, userID)
+		assert.ErrorIs(t, err, ErrAPIKeyNotValid)
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		var key *APIKey
+		userProvider.On("UseAPIKey", mock.Anything, hashAPIKey(plain)).Return(key, errors.New("test")).Once()
+
+		_, _, err := accessManager.AuthByAPIKey(context.Background(), apiKeyScheme+plain)
+		userProvider.AssertExpectations(t)
+
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrAPIKeyNotValid)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		key := &APIKey{ID: "key-id", UserID: "aaa-bbb-ccc", Scopes: []string{ScopeBalanceRead}}
+		userProvider.On("UseAPIKey", mock.Anything, hashAPIKey(plain)).Return(key, nil).Once()
+
+		userID, scopes, err := accessManager.AuthByAPIKey(context.Background(), apiKeyScheme+plain)
+		userProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Equal(t, key.UserID, userID)
+		assert.Equal(t, key.Scopes, scopes)
+	})
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	userProvider := new(mockedUserProvider)
+	accessManager := NewManager(userProvider, newTestKeySet(t), bcrypt.MinCost, LockoutPolicy{}, PasswordPolicy{})
+
+	tests := []error{nil, ErrAPIKeyNotFound}
+	for _, tt := range tests {
+		t.Run("revoke", func(t *testing.T) {
+			userProvider.On("RevokeAPIKey", mock.Anything, "aaa-bbb-ccc", "key-id").Return(tt).Once()
+			err := accessManager.RevokeAPIKey(context.Background(), "aaa-bbb-ccc", "key-id")
+			userProvider.AssertExpectations(t)
+
+			if tt != nil {
+				assert.ErrorIs(t, err, tt)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
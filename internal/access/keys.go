@@ -0,0 +1,271 @@
+package access
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	ephemeralKeyID  = "ephemeral"
+	secretKeyPrefix = "secret-"
+	keyFileExt      = ".pem"
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported key type")
+	ErrEmptySecret    = errors.New("sign secret is empty")
+)
+
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	PublicKey crypto.PublicKey
+}
+
+type KeySet struct {
+	signingKey crypto.Signer
+	signing    *Key
+	keys       map[string]*Key
+}
+
+func NewKeySet(signingKeyID string, signingKey crypto.Signer, verificationKeys ...*Key) (*KeySet, error) {
+	method, err := signingMethod(signingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	signing := &Key{
+		ID:        signingKeyID,
+		Method:    method,
+		PublicKey: signingKey.Public(),
+	}
+
+	ks := &KeySet{
+		signingKey: signingKey,
+		signing:    signing,
+		keys:       map[string]*Key{signing.ID: signing},
+	}
+
+	for _, key := range verificationKeys {
+		if key.ID == signing.ID {
+			continue
+		}
+		ks.keys[key.ID] = key
+	}
+
+	return ks, nil
+}
+
+func GenerateKeySet() (*KeySet, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("key generation error: %w", err)
+	}
+
+	return NewKeySet(ephemeralKeyID, privateKey)
+}
+
+// SecretKeySet derives the Ed25519 signing key from secret, so every instance
+// sharing the secret issues tokens the others accept, across restarts too.
+func SecretKeySet(secret string) (*KeySet, error) {
+	if secret == "" {
+		return nil, ErrEmptySecret
+	}
+
+	seed := sha256.Sum256([]byte(secret))
+	privateKey := ed25519.NewKeyFromSeed(seed[:])
+
+	kid := sha256.Sum256(privateKey.Public().(ed25519.PublicKey))
+
+	return NewKeySet(secretKeyPrefix+hex.EncodeToString(kid[:8]), privateKey)
+}
+
+func LoadKeySet(signingKeyFile, signingKeyID, verificationKeysDir string) (*KeySet, error) {
+	content, err := os.ReadFile(signingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key error: %w", err)
+	}
+
+	signingKey, err := parsePrivateKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key error: %w", err)
+	}
+
+	if signingKeyID == "" {
+		signingKeyID = strings.TrimSuffix(filepath.Base(signingKeyFile), filepath.Ext(signingKeyFile))
+	}
+
+	var verificationKeys []*Key
+	if verificationKeysDir != "" {
+		verificationKeys, err = loadVerificationKeys(verificationKeysDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewKeySet(signingKeyID, signingKey, verificationKeys...)
+}
+
+func loadVerificationKeys(dir string) ([]*Key, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("verification keys lookup error: %w", err)
+	}
+
+	keys := make([]*Key, 0, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read verification key error: %w", err)
+		}
+
+		publicKey, err := parsePublicKey(content)
+		if err != nil {
+			return nil, fmt.Errorf("parse verification key %s error: %w", file, err)
+		}
+
+		method, err := signingMethod(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &Key{
+			ID:        strings.TrimSuffix(filepath.Base(file), keyFileExt),
+			Method:    method,
+			PublicKey: publicKey,
+		})
+	}
+
+	return keys, nil
+}
+
+func parsePrivateKey(content []byte) (crypto.Signer, error) {
+	rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(content)
+	if err == nil {
+		return rsaKey, nil
+	}
+
+	edKey, err := jwt.ParseEdPrivateKeyFromPEM(content)
+	if err != nil {
+		return nil, ErrUnsupportedKey
+	}
+
+	signer, ok := edKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	return signer, nil
+}
+
+func parsePublicKey(content []byte) (crypto.PublicKey, error) {
+	rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(content)
+	if err == nil {
+		return rsaKey, nil
+	}
+
+	edKey, err := jwt.ParseEdPublicKeyFromPEM(content)
+	if err != nil {
+		return nil, ErrUnsupportedKey
+	}
+
+	return edKey, nil
+}
+
+func signingMethod(publicKey crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+
+	return token.SignedString(ks.signingKey)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("kid header not found")
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid: %s", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.PublicKey, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ks *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+
+	for _, key := range ks.keys {
+		jwk := JWK{
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Method.Alg(),
+		}
+
+		switch publicKey := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
@@ -0,0 +1,83 @@
+package access
+
+import (
+	"sync"
+	"time"
+)
+
+// unknownLogins counts failed logins for logins that don't exist, so they
+// get locked out exactly like real accounts and a lockout response doesn't
+// reveal which logins are registered.
+type unknownLogins struct {
+	mu        sync.Mutex
+	entries   map[string]*unknownLogin
+	lastSweep time.Time
+}
+
+type unknownLogin struct {
+	failedLogins int
+	lockedUntil  time.Time
+	lastFailure  time.Time
+}
+
+func newUnknownLogins() *unknownLogins {
+	return &unknownLogins{
+		entries:   make(map[string]*unknownLogin),
+		lastSweep: time.Now(),
+	}
+}
+
+func (u *unknownLogins) lockedUntil(login string) time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	e, ok := u.entries[login]
+	if !ok {
+		return time.Time{}
+	}
+
+	return e.lockedUntil
+}
+
+func (u *unknownLogins) fail(login string, policy LockoutPolicy) {
+	now := time.Now()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.sweep(now, policy)
+
+	e, ok := u.entries[login]
+	if !ok {
+		e = &unknownLogin{}
+		u.entries[login] = e
+	}
+
+	e.failedLogins++
+	e.lastFailure = now
+	if d := policy.lockDuration(e.failedLogins); d > 0 {
+		e.lockedUntil = now.Add(d)
+	}
+}
+
+// sweep forgets logins that have been quiet for longer than the longest lock.
+func (u *unknownLogins) sweep(now time.Time, policy LockoutPolicy) {
+	idle := policy.MaxDuration
+	if idle < policy.Duration {
+		idle = policy.Duration
+	}
+	if idle <= 0 {
+		idle = time.Hour
+	}
+
+	if now.Sub(u.lastSweep) < idle {
+		return
+	}
+
+	for login, e := range u.entries {
+		if now.Sub(e.lastFailure) > idle && now.After(e.lockedUntil) {
+			delete(u.entries, login)
+		}
+	}
+	u.lastSweep = now
+}
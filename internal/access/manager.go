@@ -4,10 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"math"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,73 +22,221 @@ var (
 	ErrLoginNotFound = errors.New("login not found")
 	ErrLoginPassword = errors.New("wrong login-password pair")
 	ErrTokenNotValid = errors.New("wrong access token")
+	ErrUserNotFound  = errors.New("user not found")
 )
 
+type ErrLoginLocked struct {
+	LockedUntil time.Time
+}
+
+func (e *ErrLoginLocked) Error() string {
+	return fmt.Sprintf("login locked until %s", e.LockedUntil.Format(time.RFC3339))
+}
+
 type User struct {
-	ID       string
-	Login    string
-	PassHash string
+	ID           string
+	Login        string
+	PassHash     string
+	FailedLogins int
+	LockedUntil  time.Time
+	TokenVersion int
+}
+
+// accessClaims carry the user's token version, bumped on every password
+// change, so older tokens stop working at once instead of at the next second.
+type accessClaims struct {
+	jwt.StandardClaims
+	TokenVersion int `json:"ver,omitempty"`
 }
 
 type UserProvider interface {
-	CreateUser(ctx context.Context, login, passHash string) error
+	CreateUser(ctx context.Context, login, passHash string) (userID string, err error)
 	GetUser(ctx context.Context, login string) (*User, error)
+	GetUserByID(ctx context.Context, userID string) (*User, error)
+	ChangePassHash(ctx context.Context, userID, passHash string) (tokenVersion int, err error)
+	AnonymizeUser(ctx context.Context, userID string) error
+	CreateAPIKey(ctx context.Context, key *APIKey, keyHash string) error
+	GetAPIKeys(ctx context.Context, userID string) ([]*APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID string) error
+	UseAPIKey(ctx context.Context, keyHash string) (*APIKey, error)
+	GetLinkedUser(ctx context.Context, issuer, subject string) (userID string, err error)
+	CreateLinkedUser(ctx context.Context, login, issuer, subject string) (userID string, err error)
+	UpdatePassHash(ctx context.Context, userID, passHash string) error
+	AddLoginFailure(ctx context.Context, userID string) (failedLogins int, err error)
+	SetLockedUntil(ctx context.Context, userID string, lockedUntil time.Time) error
+	ResetLoginFailures(ctx context.Context, userID string) error
+}
+
+type LockoutPolicy struct {
+	Threshold   int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+func (p LockoutPolicy) lockDuration(failedLogins int) time.Duration {
+	if p.Threshold <= 0 || failedLogins < p.Threshold {
+		return 0
+	}
+
+	// without a cap the doubling stops short of overflowing
+	d := p.Duration
+	for i := p.Threshold; i < failedLogins && (p.MaxDuration <= 0 || d < p.MaxDuration) && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		return p.MaxDuration
+	}
+
+	return d
 }
 
 type Manager struct {
 	userProvider UserProvider
-	secret       string
+	keys         *KeySet
+	tenantKeys   map[string]*KeySet
+	passCost     int
+	lockout      LockoutPolicy
+	passPolicy   PasswordPolicy
+	oidc         *OIDCProvider
+	unknown      *unknownLogins
+	dummyHash    []byte
 }
 
-func NewManager(up UserProvider, secret string) *Manager {
+func NewManager(
+	up UserProvider,
+	keys *KeySet,
+	passCost int,
+	lockout LockoutPolicy,
+	passPolicy PasswordPolicy,
+) *Manager {
+	if passCost < bcrypt.MinCost || passCost > bcrypt.MaxCost {
+		passCost = bcrypt.DefaultCost
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), passCost)
+	if err != nil {
+		panic(err)
+	}
+
 	return &Manager{
 		userProvider: up,
-		secret:       secret,
+		keys:         keys,
+		passCost:     passCost,
+		lockout:      lockout,
+		passPolicy:   passPolicy,
+		unknown:      newUnknownLogins(),
+		dummyHash:    dummyHash,
 	}
 }
 
-func (a *Manager) Register(ctx context.Context, login, password string) error {
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+func (a *Manager) Register(ctx context.Context, login, password string) (userID string, err error) {
+	err = validateLogin(login)
 	if err != nil {
-		return fmt.Errorf("password hashing error: %w", err)
+		return "", err
 	}
 
-	err = a.userProvider.CreateUser(ctx, login, string(passHash))
+	err = a.passPolicy.validate(login, password)
+	if err != nil {
+		return "", err
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), a.passCost)
+	if err != nil {
+		return "", fmt.Errorf("password hashing error: %w", err)
+	}
+
+	userID, err = a.userProvider.CreateUser(ctx, login, string(passHash))
 	if errors.Is(err, ErrLoginExists) {
-		return err
+		return "", err
 	}
 	if err != nil {
-		return fmt.Errorf("create user error: %w", err)
+		return "", fmt.Errorf("create user error: %w", err)
 	}
 
-	return nil
+	return userID, nil
 }
 
 func (a *Manager) Login(ctx context.Context, login, password string) (string, error) {
 	user, err := a.userProvider.GetUser(ctx, login)
 	if errors.Is(err, ErrLoginNotFound) {
-		return "", ErrLoginPassword
+		return "", a.unknownLoginFailure(ctx, login, password)
 	}
 	if err != nil {
 		return "", fmt.Errorf("get user error: %w", err)
 	}
 
+	if user.LockedUntil.After(time.Now()) {
+		return "", &ErrLoginLocked{LockedUntil: user.LockedUntil}
+	}
+
 	err = bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(password))
 	if err != nil {
-		return "", ErrLoginPassword
+		return "", a.registerLoginFailure(ctx, user.ID)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":    user.ID,
-		"created_at": strconv.FormatInt(time.Now().Unix(), 10),
-	})
+	if user.FailedLogins > 0 {
+		err = a.userProvider.ResetLoginFailures(ctx, user.ID)
+		if err != nil {
+			return "", fmt.Errorf("reset login failures error: %w", err)
+		}
+	}
 
-	accessToken, err := token.SignedString([]byte(a.secret))
+	err = a.rehashPassword(ctx, user, password)
 	if err != nil {
-		return "", fmt.Errorf("JWT signing error: %w", err)
+		return "", err
 	}
 
-	return bearer + accessToken, nil
+	return a.issueToken(ctx, user.ID, user.TokenVersion)
+}
+
+func (a *Manager) ChangePassword(ctx context.Context, userID, oldPassword, newPassword string) (string, error) {
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("get user error: %w", err)
+	}
+
+	if user.LockedUntil.After(time.Now()) {
+		return "", &ErrLoginLocked{LockedUntil: user.LockedUntil}
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(oldPassword))
+	if err != nil {
+		return "", a.registerLoginFailure(ctx, user.ID)
+	}
+
+	err = a.passPolicy.validate(user.Login, newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), a.passCost)
+	if err != nil {
+		return "", fmt.Errorf("password hashing error: %w", err)
+	}
+
+	tokenVersion, err := a.userProvider.ChangePassHash(ctx, userID, string(passHash))
+	if err != nil {
+		return "", fmt.Errorf("change password hash error: %w", err)
+	}
+
+	if user.FailedLogins > 0 {
+		err = a.userProvider.ResetLoginFailures(ctx, userID)
+		if err != nil {
+			return "", fmt.Errorf("reset login failures error: %w", err)
+		}
+	}
+
+	return a.issueToken(ctx, userID, tokenVersion)
+}
+
+func (a *Manager) DeleteUser(ctx context.Context, userID string) error {
+	err := a.userProvider.AnonymizeUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("anonymize user error: %w", err)
+	}
+
+	return nil
 }
 
 func (a *Manager) AuthByToken(ctx context.Context, accessToken string) (userID string, err error) {
@@ -99,37 +248,131 @@ func (a *Manager) AuthByToken(ctx context.Context, accessToken string) (userID s
 		return "", ErrTokenNotValid
 	}
 
-	token, _ := jwt.Parse(accessToken[len(bearer):], func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return []byte(a.secret), nil
-	})
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+	claims := &accessClaims{}
+	token, err := jwt.ParseWithClaims(accessToken[len(bearer):], claims, a.keySet(ctx).keyFunc)
+	if err != nil || !token.Valid {
 		return "", ErrTokenNotValid
 	}
 
-	createdAt, ok := claims["created_at"].(string)
-	if !ok {
+	tenantID := tenant.FromContext(ctx)
+	if claims.Audience != tenantID && (claims.Audience != "" || tenantID != tenant.DefaultID) {
 		return "", ErrTokenNotValid
 	}
 
-	intCreatedAt, err := strconv.ParseInt(createdAt, 10, 64)
-	if err != nil {
+	if claims.Subject == "" || claims.ExpiresAt == 0 || claims.IssuedAt == 0 {
 		return "", ErrTokenNotValid
 	}
 
-	if time.Unix(intCreatedAt, 0).Add(ttl).Before(time.Now()) {
+	userID = claims.Subject
+
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
 		return "", ErrTokenNotValid
 	}
+	if err != nil {
+		return "", fmt.Errorf("get user error: %w", err)
+	}
 
-	userID, ok = claims["user_id"].(string)
-	if !ok {
+	if claims.TokenVersion != user.TokenVersion {
 		return "", ErrTokenNotValid
 	}
 
 	return userID, nil
 }
+
+func (a *Manager) JWKS(ctx context.Context) *JWKS {
+	return a.keySet(ctx).JWKS()
+}
+
+func (a *Manager) SetTenantKeys(tenantID string, keys *KeySet) {
+	if a.tenantKeys == nil {
+		a.tenantKeys = make(map[string]*KeySet)
+	}
+	a.tenantKeys[tenantID] = keys
+}
+
+func (a *Manager) keySet(ctx context.Context) *KeySet {
+	if keys, ok := a.tenantKeys[tenant.FromContext(ctx)]; ok {
+		return keys
+	}
+
+	return a.keys
+}
+
+func (a *Manager) issueToken(ctx context.Context, userID string, tokenVersion int) (string, error) {
+	now := time.Now()
+
+	accessToken, err := a.keySet(ctx).sign(&accessClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   userID,
+			Audience:  tenant.FromContext(ctx),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		TokenVersion: tokenVersion,
+	})
+	if err != nil {
+		return "", fmt.Errorf("JWT signing error: %w", err)
+	}
+
+	return bearer + accessToken, nil
+}
+
+func (a *Manager) registerLoginFailure(ctx context.Context, userID string) error {
+	failedLogins, err := a.userProvider.AddLoginFailure(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("add login failure error: %w", err)
+	}
+
+	lockDuration := a.lockout.lockDuration(failedLogins)
+	if lockDuration == 0 {
+		return ErrLoginPassword
+	}
+
+	lockedUntil := time.Now().Add(lockDuration)
+	err = a.userProvider.SetLockedUntil(ctx, userID, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("set locked until error: %w", err)
+	}
+
+	return ErrLoginPassword
+}
+
+// unknownLoginFailure answers a login that doesn't exist the way a wrong
+// password for an existing one is answered, lockout and bcrypt time included.
+func (a *Manager) unknownLoginFailure(ctx context.Context, login, password string) error {
+	key := tenant.FromContext(ctx) + "/" + login
+
+	lockedUntil := a.unknown.lockedUntil(key)
+	if lockedUntil.After(time.Now()) {
+		return &ErrLoginLocked{LockedUntil: lockedUntil}
+	}
+
+	bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+	a.unknown.fail(key, a.lockout)
+
+	return ErrLoginPassword
+}
+
+func (a *Manager) rehashPassword(ctx context.Context, user *User, password string) error {
+	cost, err := bcrypt.Cost([]byte(user.PassHash))
+	if err != nil {
+		return fmt.Errorf("password hash cost error: %w", err)
+	}
+
+	if cost == a.passCost {
+		return nil
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), a.passCost)
+	if err != nil {
+		return fmt.Errorf("password hashing error: %w", err)
+	}
+
+	err = a.userProvider.UpdatePassHash(ctx, user.ID, string(passHash))
+	if err != nil {
+		return fmt.Errorf("update password hash error: %w", err)
+	}
+
+	return nil
+}
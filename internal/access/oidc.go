@@ -0,0 +1,424 @@
+package access
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+)
+
+const (
+	oidcTimeout       = 5 * time.Second
+	oidcStateTTL      = 10 * time.Minute
+	oidcStateAudience = "oidc-state"
+	oidcLoginPrefix   = "oidc:"
+)
+
+var (
+	ErrOIDCDisabled       = errors.New("oidc login disabled")
+	ErrOIDCState          = errors.New("wrong oidc state")
+	ErrOIDCToken          = errors.New("wrong oidc id token")
+	ErrIdentityNotFound   = errors.New("linked identity not found")
+	ErrIdentityExists     = errors.New("linked identity exists")
+	ErrOIDCNotAvailable   = errors.New("oidc provider not available")
+	errOIDCUnknownKeyID   = errors.New("unknown oidc key id")
+	errOIDCUnsupportedKey = errors.New("unsupported oidc key")
+)
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client http.Client
+	mu     sync.Mutex
+	meta   *oidcMetadata
+	keys   map[string]crypto.PublicKey
+}
+
+func NewOIDCProvider(cfg OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: http.Client{Timeout: oidcTimeout},
+	}
+}
+
+func (p *OIDCProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	meta := &oidcMetadata{}
+	err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", meta)
+	if err != nil {
+		return nil, fmt.Errorf("%w: discovery: %s", ErrOIDCNotAvailable, err)
+	}
+
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery error: issuer mismatch %s", meta.Issuer)
+	}
+
+	p.meta = meta
+
+	return meta, nil
+}
+
+func (p *OIDCProvider) authURL(ctx context.Context, state, nonce string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.cfg.ClientID},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"scope":         {"openid profile email"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return meta.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+func (p *OIDCProvider) exchange(ctx context.Context, code string) (idToken string, err error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.cfg.RedirectURL},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("new request error: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("%w: token request: %s", ErrOIDCNotAvailable, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusUnauthorized {
+		return "", ErrOIDCToken
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request not ok: %s", response.Status)
+	}
+
+	var tokenRes struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&tokenRes)
+	if err != nil {
+		return "", fmt.Errorf("json decode error: %w", err)
+	}
+
+	if tokenRes.IDToken == "" {
+		return "", ErrOIDCToken
+	}
+
+	return tokenRes.IDToken, nil
+}
+
+func (p *OIDCProvider) verify(ctx context.Context, idToken, nonce string) (subject string, err error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	var errValidation *jwt.ValidationError
+	if errors.As(err, &errValidation) && errors.Is(errValidation.Inner, ErrOIDCNotAvailable) {
+		return "", errValidation.Inner
+	}
+	if err != nil || !token.Valid {
+		return "", ErrOIDCToken
+	}
+
+	if !claims.VerifyIssuer(p.cfg.Issuer, true) || !claims.VerifyAudience(p.cfg.ClientID, true) {
+		return "", ErrOIDCToken
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return "", ErrOIDCToken
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return "", ErrOIDCToken
+	}
+
+	subject, _ = claims["sub"].(string)
+	if subject == "" {
+		return "", ErrOIDCToken
+	}
+
+	return subject, nil
+}
+
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrOIDCNotAvailable, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok = p.keys[kid]
+	if !ok {
+		return nil, errOIDCUnknownKeyID
+	}
+
+	return key, nil
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context) error {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	var jwks JWKS
+	err = p.getJSON(ctx, meta.JWKSURI, &jwks)
+	if err != nil {
+		return fmt.Errorf("jwks request error: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("new request error: %w", err)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("do request error: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("request not ok: %s", response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("read body error: %w", err)
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("json unmarshall error: %w", err)
+	}
+
+	return nil
+}
+
+func (jwk JWK) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, errOIDCUnsupportedKey
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errOIDCUnsupportedKey
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errOIDCUnsupportedKey
+	}
+}
+
+func (a *Manager) SetOIDCProvider(p *OIDCProvider) {
+	a.oidc = p
+}
+
+func (a *Manager) StartOIDC(ctx context.Context) (authURL, state string, err error) {
+	if a.oidc == nil {
+		return "", "", ErrOIDCDisabled
+	}
+
+	rawNonce := make([]byte, 16)
+	if _, err := rand.Read(rawNonce); err != nil {
+		return "", "", fmt.Errorf("nonce generation error: %w", err)
+	}
+	nonce := hex.EncodeToString(rawNonce)
+
+	now := time.Now()
+	state, err = a.keySet(ctx).sign(&jwt.StandardClaims{
+		Id:        nonce,
+		Subject:   tenant.FromContext(ctx),
+		Audience:  oidcStateAudience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("state signing error: %w", err)
+	}
+
+	authURL, err = a.oidc.authURL(ctx, state, nonce)
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// FinishOIDC logs in the user linked to the identity. The first login of an
+// identity always creates a new passwordless user, it is never linked to an
+// existing account, even one that is logged in when the flow starts.
+func (a *Manager) FinishOIDC(ctx context.Context, code, state, expectedState string) (string, error) {
+	if a.oidc == nil {
+		return "", ErrOIDCDisabled
+	}
+
+	if code == "" || state == "" || state != expectedState {
+		return "", ErrOIDCState
+	}
+
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(state, claims, a.keySet(ctx).keyFunc)
+	if err != nil || !token.Valid || !claims.VerifyAudience(oidcStateAudience, true) || claims.Id == "" ||
+		claims.Subject != tenant.FromContext(ctx) {
+		return "", ErrOIDCState
+	}
+
+	idToken, err := a.oidc.exchange(ctx, code)
+	if err != nil {
+		return "", err
+	}
+
+	subject, err := a.oidc.verify(ctx, idToken, claims.Id)
+	if err != nil {
+		return "", err
+	}
+
+	issuer := a.oidc.cfg.Issuer
+	userID, err := a.userProvider.GetLinkedUser(ctx, issuer, subject)
+	if errors.Is(err, ErrIdentityNotFound) {
+		var login string
+		login, err = oidcLogin()
+		if err != nil {
+			return "", err
+		}
+		userID, err = a.userProvider.CreateLinkedUser(ctx, login, issuer, subject)
+	}
+	// a concurrent first login of the same identity won the race
+	if errors.Is(err, ErrIdentityExists) {
+		userID, err = a.userProvider.GetLinkedUser(ctx, issuer, subject)
+	}
+	if err != nil {
+		return "", fmt.Errorf("linked user error: %w", err)
+	}
+
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("get user error: %w", err)
+	}
+
+	return a.issueToken(ctx, userID, user.TokenVersion)
+}
+
+// oidcLogin is random and outside of what the login policy lets users register,
+// so nobody can take the login of an identity before its first sign in.
+func oidcLogin() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("oidc login error: %w", err)
+	}
+	return oidcLoginPrefix + hex.EncodeToString(raw), nil
+}
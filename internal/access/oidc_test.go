@@ -0,0 +1,235 @@
+package access
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type stubIdentityProvider struct {
+	*httptest.Server
+	privateKey ed25519.PrivateKey
+	code       string
+	claims     jwt.MapClaims
+}
+
+func newStubIdentityProvider(t *testing.T) *stubIdentityProvider {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	idp := &stubIdentityProvider{privateKey: privateKey, code: "test_code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcMetadata{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{{
+			Kty: "OKP",
+			Kid: "idp-key",
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(publicKey),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "gophermart" || clientSecret != "client_secret" || r.PostFormValue("code") != idp.code {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, idp.claims)
+		token.Header["kid"] = "idp-key"
+		idToken, err := token.SignedString(idp.privateKey)
+		assert.NoError(t, err)
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+
+	return idp
+}
+
+func TestOIDC(t *testing.T) {
+	idp := newStubIdentityProvider(t)
+	defer idp.Close()
+
+	userProvider := new(mockedUserProvider)
+	accessManager := NewManager(userProvider, newTestKeySet(t), bcrypt.MinCost, LockoutPolicy{}, PasswordPolicy{})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, _, err := accessManager.StartOIDC(context.Background())
+		assert.ErrorIs(t, err, ErrOIDCDisabled)
+	})
+
+	accessManager.SetOIDCProvider(NewOIDCProvider(OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "gophermart",
+		ClientSecret: "client_secret",
+		RedirectURL:  "http://localhost:8080/api/user/oidc/callback",
+	}))
+
+	start := func(t *testing.T) (state, nonce string) {
+		authURL, state, err := accessManager.StartOIDC(context.Background())
+		assert.NoError(t, err)
+
+		u, err := url.Parse(authURL)
+		assert.NoError(t, err)
+		assert.Equal(t, idp.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+		assert.Equal(t, "gophermart", u.Query().Get("client_id"))
+		assert.Equal(t, state, u.Query().Get("state"))
+
+		return state, u.Query().Get("nonce")
+	}
+
+	claims := func(nonce string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   []string{"gophermart"},
+			"sub":   "external-subject",
+			"nonce": nonce,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	t.Run("state mismatch", func(t *testing.T) {
+		state, _ := start(t)
+		_, err := accessManager.FinishOIDC(context.Background(), idp.code, state, "other_state")
+		assert.ErrorIs(t, err, ErrOIDCState)
+	})
+
+	t.Run("forged state", func(t *testing.T) {
+		_, err := accessManager.FinishOIDC(context.Background(), idp.code, "forged", "forged")
+		assert.ErrorIs(t, err, ErrOIDCState)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		state, _ := start(t)
+		_, err := accessManager.FinishOIDC(context.Background(), "wrong_code", state, state)
+		assert.ErrorIs(t, err, ErrOIDCToken)
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		state, _ := start(t)
+		idp.claims = claims("other_nonce")
+		_, err := accessManager.FinishOIDC(context.Background(), idp.code, state, state)
+		assert.ErrorIs(t, err, ErrOIDCToken)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		state, nonce := start(t)
+		idp.claims = claims(nonce)
+		idp.claims["aud"] = "other_client"
+		_, err := accessManager.FinishOIDC(context.Background(), idp.code, state, state)
+		assert.ErrorIs(t, err, ErrOIDCToken)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		state, nonce := start(t)
+		idp.claims = claims(nonce)
+		idp.claims["exp"] = time.Now().Add(-time.Minute).Unix()
+		_, err := accessManager.FinishOIDC(context.Background(), idp.code, state, state)
+		assert.ErrorIs(t, err, ErrOIDCToken)
+	})
+
+	t.Run("new user", func(t *testing.T) {
+		state, nonce := start(t)
+		idp.claims = claims(nonce)
+
+		userProvider.On("GetLinkedUser", mock.Anything, idp.URL, "external-subject").Return("", ErrIdentityNotFound).Once()
+		userProvider.On("CreateLinkedUser", mock.Anything, mock.MatchedBy(isOIDCLogin), idp.URL, "external-subject").
+			Return("aaa-bbb-ccc", nil).Once()
+		userProvider.On("GetUserByID", mock.Anything, "aaa-bbb-ccc").Return(&User{ID: "aaa-bbb-ccc"}, nil).Once()
+
+		accessToken, err := accessManager.FinishOIDC(context.Background(), idp.code, state, state)
+		userProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Regexp(t, "^Bearer\\s[\\w-.]+\\w$", accessToken)
+	})
+
+	t.Run("concurrent first login", func(t *testing.T) {
+		state, nonce := start(t)
+		idp.claims = claims(nonce)
+
+		userProvider.On("GetLinkedUser", mock.Anything, idp.URL, "external-subject").Return("", ErrIdentityNotFound).Once()
+		userProvider.On("CreateLinkedUser", mock.Anything, mock.MatchedBy(isOIDCLogin), idp.URL, "external-subject").
+			Return("", ErrIdentityExists).Once()
+		userProvider.On("GetLinkedUser", mock.Anything, idp.URL, "external-subject").Return("aaa-bbb-ccc", nil).Once()
+		userProvider.On("GetUserByID", mock.Anything, "aaa-bbb-ccc").Return(&User{ID: "aaa-bbb-ccc"}, nil).Once()
+
+		accessToken, err := accessManager.FinishOIDC(context.Background(), idp.code, state, state)
+		userProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, accessToken)
+	})
+
+	t.Run("linked user", func(t *testing.T) {
+		state, nonce := start(t)
+		idp.claims = claims(nonce)
+
+		userProvider.On("GetLinkedUser", mock.Anything, idp.URL, "external-subject").Return("aaa-bbb-ccc", nil).Once()
+		userProvider.On("GetUserByID", mock.Anything, "aaa-bbb-ccc").Return(&User{ID: "aaa-bbb-ccc"}, nil).Twice()
+
+		accessToken, err := accessManager.FinishOIDC(context.Background(), idp.code, state, state)
+		assert.NoError(t, err)
+
+		userID, err := accessManager.AuthByToken(context.Background(), accessToken)
+		userProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "aaa-bbb-ccc", userID)
+	})
+
+	t.Run("login taken", func(t *testing.T) {
+		state, nonce := start(t)
+		idp.claims = claims(nonce)
+
+		userProvider.On("GetLinkedUser", mock.Anything, idp.URL, "external-subject").Return("", ErrIdentityNotFound).Once()
+		userProvider.On("CreateLinkedUser", mock.Anything, mock.MatchedBy(isOIDCLogin), idp.URL, "external-subject").
+			Return("", ErrLoginExists).Once()
+
+		_, err := accessManager.FinishOIDC(context.Background(), idp.code, state, state)
+		userProvider.AssertExpectations(t)
+
+		assert.ErrorIs(t, err, ErrLoginExists)
+	})
+}
+
+func isOIDCLogin(login string) bool {
+	return strings.HasPrefix(login, oidcLoginPrefix)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	first, err := oidcLogin()
+	require.NoError(t, err)
+	second, err := oidcLogin()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+	assert.Error(t, validateLogin(first), "registration can't take an oidc login")
+}
@@ -0,0 +1,72 @@
+package access
+
+import (
+	"errors"
+	"regexp"
+	"unicode"
+)
+
+const maxPasswordLength = 72
+
+var (
+	ErrLoginFormat      = errors.New("wrong login format")
+	ErrPasswordTooShort = errors.New("password too short")
+	ErrPasswordTooLong  = errors.New("password too long")
+	ErrPasswordTooWeak  = errors.New("password too weak")
+)
+
+var loginRegexp = regexp.MustCompile(`^[a-zA-Z0-9._@+-]{3,255}$`)
+
+type PasswordPolicy struct {
+	MinLength  int
+	MinClasses int
+}
+
+func (p PasswordPolicy) validate(login, password string) error {
+	if len(password) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+
+	if len(password) > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	if password == login {
+		return ErrPasswordTooWeak
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, ok := range []bool{lower, upper, digit, other} {
+		if ok {
+			classes++
+		}
+	}
+
+	if classes < p.MinClasses {
+		return ErrPasswordTooWeak
+	}
+
+	return nil
+}
+
+func validateLogin(login string) error {
+	if !loginRegexp.MatchString(login) {
+		return ErrLoginFormat
+	}
+
+	return nil
+}
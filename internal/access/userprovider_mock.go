@@ -2,6 +2,7 @@ package access
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -10,12 +11,77 @@ type mockedUserProvider struct {
 	mock.Mock
 }
 
-func (m *mockedUserProvider) CreateUser(ctx context.Context, login, passHash string) error {
+func (m *mockedUserProvider) CreateUser(ctx context.Context, login, passHash string) (string, error) {
 	args := m.Called(ctx, login, passHash)
-	return args.Error(0)
+	return args.String(0), args.Error(1)
 }
 
 func (m *mockedUserProvider) GetUser(ctx context.Context, login string) (*User, error) {
 	args := m.Called(ctx, login)
 	return args.Get(0).(*User), args.Error(1)
 }
+
+func (m *mockedUserProvider) UpdatePassHash(ctx context.Context, userID, passHash string) error {
+	args := m.Called(ctx, userID, passHash)
+	return args.Error(0)
+}
+
+func (m *mockedUserProvider) AddLoginFailure(ctx context.Context, userID string) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockedUserProvider) SetLockedUntil(ctx context.Context, userID string, lockedUntil time.Time) error {
+	args := m.Called(ctx, userID, lockedUntil)
+	return args.Error(0)
+}
+
+func (m *mockedUserProvider) ResetLoginFailures(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *mockedUserProvider) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(*User), args.Error(1)
+}
+
+func (m *mockedUserProvider) ChangePassHash(ctx context.Context, userID, passHash string) (int, error) {
+	args := m.Called(ctx, userID, passHash)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockedUserProvider) AnonymizeUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *mockedUserProvider) CreateAPIKey(ctx context.Context, key *APIKey, keyHash string) error {
+	args := m.Called(ctx, key, keyHash)
+	return args.Error(0)
+}
+
+func (m *mockedUserProvider) GetAPIKeys(ctx context.Context, userID string) ([]*APIKey, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]*APIKey), args.Error(1)
+}
+
+func (m *mockedUserProvider) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	args := m.Called(ctx, userID, keyID)
+	return args.Error(0)
+}
+
+func (m *mockedUserProvider) UseAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	args := m.Called(ctx, keyHash)
+	return args.Get(0).(*APIKey), args.Error(1)
+}
+
+func (m *mockedUserProvider) GetLinkedUser(ctx context.Context, issuer, subject string) (string, error) {
+	args := m.Called(ctx, issuer, subject)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockedUserProvider) CreateLinkedUser(ctx context.Context, login, issuer, subject string) (string, error) {
+	args := m.Called(ctx, login, issuer, subject)
+	return args.String(0), args.Error(1)
+}
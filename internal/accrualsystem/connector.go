@@ -46,12 +46,12 @@ func NewConnector(address string) *Connector {
 	}
 }
 
-func (c *Connector) GetAccrual(ctx context.Context, orderID int) (status string, accrual int, err error) {
+func (c *Connector) GetAccrual(ctx context.Context, orderID string) (status string, accrual int, err error) {
 	if time.Now().Before(c.availableSince) {
 		return "", 0, &ErrNotAvailable{AvailableSince: c.availableSince}
 	}
 
-	url := c.address + "/api/orders/" + strconv.Itoa(orderID)
+	url := c.address + "/api/orders/" + orderID
 	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return "", 0, fmt.Errorf("new request error: %w", err)
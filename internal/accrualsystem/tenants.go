@@ -0,0 +1,27 @@
+package accrualsystem
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+)
+
+type TenantConnector struct {
+	connectors map[string]*Connector
+}
+
+func NewTenantConnector(connectors map[string]*Connector) *TenantConnector {
+	return &TenantConnector{connectors: connectors}
+}
+
+func (t *TenantConnector) GetAccrual(ctx context.Context, orderID string) (status string, accrual int, err error) {
+	tenantID := tenant.FromContext(ctx)
+
+	connector, ok := t.connectors[tenantID]
+	if !ok {
+		return "", 0, fmt.Errorf("no accrual system for tenant %q", tenantID)
+	}
+
+	return connector.GetAccrual(ctx, orderID)
+}
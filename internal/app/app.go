@@ -2,18 +2,30 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"runtime"
-	"time"
+	"sync"
 
 	"github.com/ruskiiamov/gophermart/internal/access"
 	"github.com/ruskiiamov/gophermart/internal/accrualsystem"
 	"github.com/ruskiiamov/gophermart/internal/bonus"
 	"github.com/ruskiiamov/gophermart/internal/config"
 	"github.com/ruskiiamov/gophermart/internal/database"
+	"github.com/ruskiiamov/gophermart/internal/grpcserver"
+	"github.com/ruskiiamov/gophermart/internal/logger"
 	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
 	"github.com/ruskiiamov/gophermart/internal/server"
 	"github.com/ruskiiamov/gophermart/internal/tasks"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+	"github.com/ruskiiamov/gophermart/internal/tlsconfig"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 )
 
 func Run(ctx context.Context, g *errgroup.Group, cfg *config.Config) {
@@ -21,12 +33,154 @@ func Run(ctx context.Context, g *errgroup.Group, cfg *config.Config) {
 	if err != nil {
 		panic(err)
 	}
+	if cfg.DatabaseReplicaURI != "" {
+		err = dbConnection.SetReplica(ctx, cfg.DatabaseReplicaURI, cfg.ReplicaMaxLag)
+		if err != nil {
+			panic(err)
+		}
+		go dbConnection.WatchReplica(ctx, cfg.ReplicaCheckInterval)
+	}
 
-	accrualProvider := accrualsystem.NewConnector(cfg.AccrualSystemAddress)
-	accessManager := access.NewManager(dbConnection, cfg.SignSecret)
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	tenants, err := loadTenants(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	accrualConnectors := make(map[string]*accrualsystem.Connector)
+	for _, t := range tenants.Tenants() {
+		address := t.AccrualSystemAddress
+		if address == "" {
+			address = cfg.AccrualSystemAddress
+		}
+		accrualConnectors[t.ID] = accrualsystem.NewConnector(address)
+	}
+	accrualProvider := accrualsystem.NewTenantConnector(accrualConnectors)
+
+	accessManager := access.NewManager(dbConnection, keys, cfg.PassHashCost, access.LockoutPolicy{
+		Threshold:   cfg.LockoutThreshold,
+		Duration:    cfg.LockoutDuration,
+		MaxDuration: cfg.LockoutMaxDuration,
+	}, access.PasswordPolicy{
+		MinLength:  cfg.PasswordMinLength,
+		MinClasses: cfg.PasswordMinClasses,
+	})
+	if cfg.OIDCIssuer != "" {
+		accessManager.SetOIDCProvider(access.NewOIDCProvider(access.OIDCConfig{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+		}))
+	}
+	for _, t := range tenants.Tenants() {
+		if t.SigningKeyFile == "" {
+			continue
+		}
+
+		tenantKeys, err := access.LoadKeySet(t.SigningKeyFile, t.SigningKeyID, t.VerificationKeysDir)
+		if err != nil {
+			panic(fmt.Errorf("tenant %s keys error: %w", t.ID, err))
+		}
+		accessManager.SetTenantKeys(t.ID, tenantKeys)
+	}
 	bonusManager := bonus.NewManager(dbConnection, accrualProvider)
-	taskDispatcher := queue.NewDispatcher(ctx)
-	server := server.NewServer(ctx, cfg.RunAddress, accessManager, bonusManager, taskDispatcher)
+	if cfg.LoyaltyTiers != "" {
+		tiers, err := bonus.ParseTiers(cfg.LoyaltyTiers)
+		if err != nil {
+			panic(err)
+		}
+		bonusManager.SetTiers(tiers)
+	}
+	bonusManager.SetReferralPolicy(bonus.ReferralPolicy{
+		ReferrerReward: cfg.ReferrerReward * 100,
+		RefereeReward:  cfg.RefereeReward * 100,
+		MinAccrual:     cfg.ReferralMinAccrual * 100,
+		Window:         cfg.ReferralWindow,
+		MaxRewards:     cfg.ReferralMaxRewards,
+		Period:         cfg.ReferralPeriod,
+	})
+	bonusManager.SetTransferPolicy(bonus.TransferPolicy{
+		DailyLimit: cfg.TransferDailyLimit * 100,
+		TTL:        cfg.TransferTTL,
+	})
+	bonusManager.SetHoldTTL(cfg.HoldTTL)
+	taskDispatcher := queue.NewDispatcher()
+	limiters := ratelimit.Limiters{
+		Register: ratelimit.NewLimiter(cfg.RegisterRateLimit, cfg.RateLimitPeriod),
+		Login:    ratelimit.NewLimiter(cfg.IPRateLimit, cfg.RateLimitPeriod),
+		OIDC:     ratelimit.NewLimiter(cfg.OIDCRateLimit, cfg.RateLimitPeriod),
+		Account:  ratelimit.NewLimiter(cfg.LoginRateLimit, cfg.RateLimitPeriod),
+	}
+	bodyLimits := server.BodyLimits{
+		Default: cfg.MaxBodySize,
+		Batch:   cfg.MaxBatchBodySize,
+	}
+	timeouts := server.Timeouts{
+		Read:       cfg.ReadTimeout,
+		ReadHeader: cfg.ReadHeaderTimeout,
+		Write:      cfg.WriteTimeout,
+		Idle:       cfg.IdleTimeout,
+	}
+	sameSite, err := server.ParseSameSite(cfg.CookieSameSite)
+	if err != nil {
+		panic(err)
+	}
+	adminToken := cfg.AdminToken
+	var adminServer *http.Server
+	if cfg.AdminAddress != "" {
+		adminToken = ""
+		adminServer = server.NewAdminServer(
+			ctx,
+			cfg.AdminAddress,
+			bonusManager,
+			tenants,
+			cfg.AdminToken,
+			cfg.AdminClientCAFile != "",
+			bodyLimits,
+			timeouts,
+		)
+	}
+	httpServer := server.NewServer(
+		ctx,
+		cfg.RunAddress,
+		accessManager,
+		bonusManager,
+		taskDispatcher,
+		limiters,
+		tenants,
+		adminToken,
+		cfg.ValidateResponses,
+		bodyLimits,
+		timeouts,
+		server.CORSConfig{
+			AllowedOrigins: cfg.CORSAllowedOrigins,
+			MaxAge:         cfg.CORSMaxAge,
+		},
+		server.CookieConfig{
+			Enabled:  cfg.CookieSessions,
+			Secure:   cfg.CookieSecure,
+			SameSite: sameSite,
+			Domain:   cfg.CookieDomain,
+		},
+		cfg.ResponseCacheTTL,
+	)
+	err = configureTLS(ctx, cfg, httpServer, adminServer)
+	if err != nil {
+		panic(err)
+	}
+	grpcServer := grpcserver.NewServer(
+		accessManager,
+		bonusManager,
+		taskDispatcher,
+		limiters,
+		tenants,
+		httpServer.TLSConfig,
+	)
 
 	err = dbConnection.Migrate()
 	if err != nil {
@@ -37,36 +191,218 @@ func Run(ctx context.Context, g *errgroup.Group, cfg *config.Config) {
 	if err != nil {
 		panic(err)
 	}
+	accrualTasks := make([]*queue.Task, 0, len(orders))
 	for _, order := range orders {
-		taskDispatcher.Push(tasks.NewAccrualTask(bonusManager, order.ID))
+		accrualTasks = append(accrualTasks, tasks.NewAccrualTask(order.TenantID, order.ID))
 	}
+	taskDispatcher.PushMany(accrualTasks)
+
+	taskRegistry := queue.NewRegistry()
+	taskRegistry.Register(tasks.AccrualType, tasks.NewAccrualHandler(bonusManager))
+	taskRegistry.Register(tasks.TiersType, tasks.NewTiersHandler(bonusManager))
+	taskRegistry.Register(tasks.HoldsType, tasks.NewHoldsHandler(bonusManager))
+
+	taskCtx, taskCancel := context.WithCancel(context.Background())
+	var workersWG sync.WaitGroup
 
-	workers := make([]*queue.Worker, 0, runtime.NumCPU())
 	for i := 0; i < runtime.NumCPU(); i++ {
-		workers = append(workers, queue.NewWorker(taskDispatcher))
+		worker := queue.NewWorker(taskDispatcher, taskRegistry)
+		workersWG.Add(1)
+		go func() {
+			defer workersWG.Done()
+			worker.Loop(taskCtx)
+		}()
 	}
-	for _, w := range workers {
-		worker := w
-		g.Go(func() error {
-			worker.Loop(ctx)
-			return nil
+
+	if cfg.TiersInterval > 0 {
+		go queue.Every(ctx, taskDispatcher, cfg.TiersInterval, func() []*queue.Task {
+			tiersTasks := make([]*queue.Task, 0)
+			for _, t := range tenants.Tenants() {
+				tiersTasks = append(tiersTasks, tasks.NewTiersTask(t.ID))
+			}
+			return tiersTasks
+		})
+	}
+
+	if cfg.HoldsInterval > 0 {
+		go queue.Every(ctx, taskDispatcher, cfg.HoldsInterval, func() []*queue.Task {
+			holdsTasks := make([]*queue.Task, 0)
+			for _, t := range tenants.Tenants() {
+				holdsTasks = append(holdsTasks, tasks.NewHoldsTask(t.ID))
+			}
+			return holdsTasks
 		})
 	}
 
 	g.Go(func() error {
-		return server.ListenAndServe()
+		return listenAndServe(httpServer)
 	})
 
+	if adminServer != nil {
+		g.Go(func() error {
+			return listenAndServe(adminServer)
+		})
+	}
+
+	if cfg.GRPCAddress != "" {
+		g.Go(func() error {
+			listener, err := net.Listen("tcp", cfg.GRPCAddress)
+			if err != nil {
+				return fmt.Errorf("grpc listen error: %w", err)
+			}
+
+			return grpcServer.Serve(listener)
+		})
+	}
+
 	g.Go(func() error {
 		<-ctx.Done()
 
-		sdCtx, sdCancel := context.WithTimeout(context.Background(), 2*time.Second)
+		sdCtx, sdCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 		defer sdCancel()
 
-		server.Shutdown(sdCtx)
+		var sdErr error
+
+		err := httpServer.Shutdown(sdCtx)
+		if err != nil {
+			sdErr = fmt.Errorf("server shutdown error: %w", err)
+		}
+
+		if adminServer != nil {
+			err = adminServer.Shutdown(sdCtx)
+			if err != nil && sdErr == nil {
+				sdErr = fmt.Errorf("admin server shutdown error: %w", err)
+			}
+		}
+
+		err = stopGRPC(sdCtx, grpcServer)
+		if err != nil && sdErr == nil {
+			sdErr = fmt.Errorf("grpc server shutdown error: %w", err)
+		}
+
 		taskDispatcher.Close()
+		if pending := taskDispatcher.Len(); pending > 0 {
+			logger.Info(fmt.Sprintf("%d pending tasks left in queue", pending))
+		}
+
+		err = waitWorkers(sdCtx, &workersWG)
+		if err != nil {
+			taskCancel()
+			workersWG.Wait()
+			logger.Error(fmt.Sprintf("tasks draining error: %s", err))
+			if sdErr == nil {
+				sdErr = fmt.Errorf("tasks draining error: %w", err)
+			}
+		}
+		taskCancel()
+
 		dbConnection.Close()
 
-		return nil
+		return sdErr
 	})
 }
+
+func loadKeys(cfg *config.Config) (*access.KeySet, error) {
+	if cfg.SigningKeyFile == "" {
+		logger.Info("signing key file not set, signing key derived from sign secret")
+		return access.SecretKeySet(cfg.SignSecret)
+	}
+
+	return access.LoadKeySet(cfg.SigningKeyFile, cfg.SigningKeyID, cfg.VerificationKeysDir)
+}
+
+func loadTenants(cfg *config.Config) (*tenant.Registry, error) {
+	if cfg.TenantsFile == "" {
+		return tenant.NewRegistry(&tenant.Tenant{ID: tenant.DefaultID})
+	}
+
+	return tenant.LoadRegistry(cfg.TenantsFile)
+}
+
+func configureTLS(ctx context.Context, cfg *config.Config, httpServer, adminServer *http.Server) error {
+	if cfg.AdminClientCAFile != "" && adminServer == nil {
+		return errors.New("admin client ca requires admin address")
+	}
+
+	if cfg.TLSCertFile == "" {
+		if cfg.AdminClientCAFile != "" {
+			return errors.New("admin client ca requires tls certificate")
+		}
+
+		if cfg.HTTP2Cleartext {
+			httpServer.Handler = h2c.NewHandler(httpServer.Handler, &http2.Server{IdleTimeout: cfg.IdleTimeout})
+		}
+
+		return nil
+	}
+
+	certs, err := tlsconfig.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+	if cfg.TLSReloadInterval > 0 {
+		go certs.Watch(ctx, cfg.TLSReloadInterval)
+	}
+
+	httpServer.TLSConfig, err = tlsconfig.ServerConfig(certs, "")
+	if err != nil {
+		return err
+	}
+
+	if adminServer == nil {
+		return nil
+	}
+
+	adminServer.TLSConfig, err = tlsconfig.ServerConfig(certs, cfg.AdminClientCAFile)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func listenAndServe(s *http.Server) error {
+	var err error
+	if s.TLSConfig != nil {
+		err = s.ListenAndServeTLS("", "")
+	} else {
+		err = s.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func waitWorkers(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func stopGRPC(ctx context.Context, s *grpc.Server) error {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
@@ -10,7 +10,7 @@ type mockedAccrualProvider struct {
 	mock.Mock
 }
 
-func (m *mockedAccrualProvider) GetAccrual(ctx context.Context, orderID int) (status string, accrual int, err error) {
+func (m *mockedAccrualProvider) GetAccrual(ctx context.Context, orderID string) (status string, accrual int, err error) {
 	args := m.Called(ctx, orderID)
 	return args.String(0), args.Int(1), args.Error(2)
 }
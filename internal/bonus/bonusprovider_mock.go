@@ -2,6 +2,7 @@ package bonus
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -10,17 +11,32 @@ type mockedBonusProvider struct {
 	mock.Mock
 }
 
-func (m *mockedBonusProvider) CreateOrder(ctx context.Context, userID string, orderID int) (*Order, error) {
+func (m *mockedBonusProvider) CreateOrder(ctx context.Context, userID string, orderID string) (*Order, error) {
 	args := m.Called(ctx, userID, orderID)
 	return args.Get(0).(*Order), args.Error(1)
 }
 
-func (m *mockedBonusProvider) UpdateOrder(ctx context.Context, orderID, accrual int, status string) error {
+func (m *mockedBonusProvider) CreateOrders(ctx context.Context, userID string, orderIDs []string) (map[string]string, error) {
+	args := m.Called(ctx, userID, orderIDs)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *mockedBonusProvider) UpdateOrder(ctx context.Context, orderID string, accrual int, status string) error {
 	args := m.Called(ctx, orderID, accrual, status)
 	return args.Error(0)
 }
 
-func (m *mockedBonusProvider) GetOrder(ctx context.Context, orderID int) (*Order, error) {
+func (m *mockedBonusProvider) ProcessOrder(ctx context.Context, orderID string, accrual int, rewards *OrderRewards) error {
+	args := m.Called(ctx, orderID, accrual, rewards)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) AddOrderCheck(ctx context.Context, orderID string) error {
+	args := m.Called(ctx, orderID)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) GetOrder(ctx context.Context, orderID string) (*Order, error) {
 	args := m.Called(ctx, orderID)
 	return args.Get(0).(*Order), args.Error(1)
 }
@@ -35,12 +51,12 @@ func (m *mockedBonusProvider) GetNotFinalOrders(ctx context.Context) ([]*Order,
 	return args.Get(0).([]*Order), args.Error(1)
 }
 
-func (m *mockedBonusProvider) GetBalance(ctx context.Context, userID string) (current, withdrawn int, err error) {
+func (m *mockedBonusProvider) GetBalance(ctx context.Context, userID string) (current, withdrawn, held int, err error) {
 	args := m.Called(ctx, userID)
-	return args.Int(0), args.Int(1), args.Error(2)
+	return args.Int(0), args.Int(1), args.Int(2), args.Error(3)
 }
 
-func (m *mockedBonusProvider) CreateWithdraw(ctx context.Context, userID string, orderID, sum int) error {
+func (m *mockedBonusProvider) CreateWithdraw(ctx context.Context, userID string, orderID string, sum int) error {
 	args := m.Called(ctx, userID, orderID, sum)
 	return args.Error(0)
 }
@@ -49,3 +65,161 @@ func (m *mockedBonusProvider) GetWithdrawals(ctx context.Context, userID string)
 	args := m.Called(ctx, userID)
 	return args.Get(0).([]*Withdrawal), args.Error(1)
 }
+
+func (m *mockedBonusProvider) GetDataVersion(ctx context.Context, userID string) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockedBonusProvider) GetBalanceAt(ctx context.Context, userID string, at time.Time) (int, error) {
+	args := m.Called(ctx, userID, at)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockedBonusProvider) IterateLedger(
+	ctx context.Context,
+	userID string,
+	from, to time.Time,
+	fn func(*LedgerEntry) error,
+) error {
+	args := m.Called(ctx, userID, from, to, fn)
+
+	for _, entry := range args.Get(0).([]*LedgerEntry) {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return args.Error(1)
+}
+
+func (m *mockedBonusProvider) GetUserTier(ctx context.Context, userID string) (string, int, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Int(1), args.Error(2)
+}
+
+func (m *mockedBonusProvider) SetUserTier(ctx context.Context, userID, tier string, rollingAccrual int) error {
+	args := m.Called(ctx, userID, tier, rollingAccrual)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) IterateRollingAccruals(
+	ctx context.Context,
+	since time.Time,
+	fn func(userID string, accrual int) error,
+) error {
+	args := m.Called(ctx, since, fn)
+
+	for userID, accrual := range args.Get(0).(map[string]int) {
+		if err := fn(userID, accrual); err != nil {
+			return err
+		}
+	}
+
+	return args.Error(1)
+}
+
+func (m *mockedBonusProvider) CreateCampaign(ctx context.Context, c *Campaign) error {
+	args := m.Called(ctx, c)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) UpdateCampaign(ctx context.Context, c *Campaign) error {
+	args := m.Called(ctx, c)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) GetCampaign(ctx context.Context, campaignID string) (*Campaign, error) {
+	args := m.Called(ctx, campaignID)
+	return args.Get(0).(*Campaign), args.Error(1)
+}
+
+func (m *mockedBonusProvider) GetCampaigns(ctx context.Context) ([]*Campaign, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*Campaign), args.Error(1)
+}
+
+func (m *mockedBonusProvider) GetActiveCampaigns(ctx context.Context, at time.Time) ([]*Campaign, error) {
+	args := m.Called(ctx, at)
+	return args.Get(0).([]*Campaign), args.Error(1)
+}
+
+func (m *mockedBonusProvider) CountProcessedOrders(ctx context.Context, userID string) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockedBonusProvider) GetReferralCode(ctx context.Context, userID string) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockedBonusProvider) SetReferralCode(ctx context.Context, userID, code string) error {
+	args := m.Called(ctx, userID, code)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) GetUserByReferralCode(ctx context.Context, code string) (string, error) {
+	args := m.Called(ctx, code)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockedBonusProvider) CreateReferral(ctx context.Context, referrerID, refereeID string) error {
+	args := m.Called(ctx, referrerID, refereeID)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) GetReferral(ctx context.Context, refereeID string) (*Referral, error) {
+	args := m.Called(ctx, refereeID)
+	return args.Get(0).(*Referral), args.Error(1)
+}
+
+func (m *mockedBonusProvider) GetReferrals(ctx context.Context, referrerID string) ([]*Referral, error) {
+	args := m.Called(ctx, referrerID)
+	return args.Get(0).([]*Referral), args.Error(1)
+}
+
+func (m *mockedBonusProvider) CountReferralRewards(ctx context.Context, referrerID string, since time.Time) (int, error) {
+	args := m.Called(ctx, referrerID, since)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockedBonusProvider) GetRecipient(ctx context.Context, login string) (string, error) {
+	args := m.Called(ctx, login)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockedBonusProvider) CreateTransfer(ctx context.Context, t *Transfer) error {
+	args := m.Called(ctx, t)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) CompleteTransfer(ctx context.Context, t *Transfer, dailyLimit int, since time.Time) error {
+	args := m.Called(ctx, t, dailyLimit, since)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) GetTransfers(ctx context.Context, userID string) ([]*Transfer, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]*Transfer), args.Error(1)
+}
+
+func (m *mockedBonusProvider) CreateHold(ctx context.Context, h *Hold) error {
+	args := m.Called(ctx, h)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) CaptureHold(ctx context.Context, h *Hold) error {
+	args := m.Called(ctx, h)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) ReleaseHold(ctx context.Context, h *Hold) error {
+	args := m.Called(ctx, h)
+	return args.Error(0)
+}
+
+func (m *mockedBonusProvider) ReleaseExpiredHolds(ctx context.Context, at time.Time) (int, error) {
+	args := m.Called(ctx, at)
+	return args.Int(0), args.Error(1)
+}
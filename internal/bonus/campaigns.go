@@ -0,0 +1,205 @@
+package bonus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrCampaignRule     = errors.New("wrong campaign rule")
+)
+
+type CampaignProvider interface {
+	CreateCampaign(ctx context.Context, c *Campaign) error
+	UpdateCampaign(ctx context.Context, c *Campaign) error
+	GetCampaign(ctx context.Context, campaignID string) (*Campaign, error)
+	GetCampaigns(ctx context.Context) ([]*Campaign, error)
+	GetActiveCampaigns(ctx context.Context, at time.Time) ([]*Campaign, error)
+	CountProcessedOrders(ctx context.Context, userID string) (int, error)
+}
+
+// Campaign conditions are all optional, zero values match any order. The
+// credit is the extra part of the multiplied accrual plus the fixed bonus.
+type Campaign struct {
+	ID         string
+	Name       string
+	StartsAt   time.Time
+	EndsAt     time.Time
+	MinOrders  int
+	MaxOrders  int
+	Tiers      []string
+	MinAccrual int
+	Multiplier float64
+	Bonus      int
+	Active     bool
+	CreatedAt  time.Time
+}
+
+type BonusCredit struct {
+	Kind       string
+	UserID     string
+	OrderID    string
+	CampaignID string
+	Amount     int
+}
+
+type orderFacts struct {
+	at         time.Time
+	orderCount int
+	tier       string
+	accrual    int
+}
+
+func (c *Campaign) validate() error {
+	switch {
+	case c.Name == "" || len(c.Name) > 255:
+		return fmt.Errorf("%w: name", ErrCampaignRule)
+	case !c.StartsAt.IsZero() && !c.EndsAt.IsZero() && !c.StartsAt.Before(c.EndsAt):
+		return fmt.Errorf("%w: period", ErrCampaignRule)
+	case c.MinOrders < 0 || c.MaxOrders < 0 || (c.MaxOrders > 0 && c.MaxOrders < c.MinOrders):
+		return fmt.Errorf("%w: order count", ErrCampaignRule)
+	case c.MinAccrual < 0:
+		return fmt.Errorf("%w: accrual", ErrCampaignRule)
+	case c.Multiplier != 0 && c.Multiplier < 1, c.Bonus < 0:
+		return fmt.Errorf("%w: action", ErrCampaignRule)
+	case c.Multiplier <= 1 && c.Bonus == 0:
+		return fmt.Errorf("%w: no action", ErrCampaignRule)
+	}
+
+	return nil
+}
+
+func (c *Campaign) matches(f *orderFacts) bool {
+	if !c.Active {
+		return false
+	}
+	if !c.StartsAt.IsZero() && f.at.Before(c.StartsAt) {
+		return false
+	}
+	if !c.EndsAt.IsZero() && !f.at.Before(c.EndsAt) {
+		return false
+	}
+	if f.orderCount < c.MinOrders || (c.MaxOrders > 0 && f.orderCount > c.MaxOrders) {
+		return false
+	}
+	if f.accrual < c.MinAccrual {
+		return false
+	}
+
+	if len(c.Tiers) == 0 {
+		return true
+	}
+	for _, tier := range c.Tiers {
+		if tier == f.tier {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Campaign) credit(accrual int) int {
+	credit := c.Bonus
+	if c.Multiplier > 1 {
+		credit += int(math.Round(float64(accrual) * (c.Multiplier - 1)))
+	}
+
+	return credit
+}
+
+func (b *Manager) CreateCampaign(ctx context.Context, c *Campaign) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	err = b.bonusProvider.CreateCampaign(ctx, c)
+	if err != nil {
+		return fmt.Errorf("create campaign error: %w", err)
+	}
+
+	return nil
+}
+
+func (b *Manager) UpdateCampaign(ctx context.Context, c *Campaign) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	err = b.bonusProvider.UpdateCampaign(ctx, c)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("update campaign error: %w", err)
+	}
+
+	return nil
+}
+
+func (b *Manager) GetCampaign(ctx context.Context, campaignID string) (*Campaign, error) {
+	c, err := b.bonusProvider.GetCampaign(ctx, campaignID)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get campaign error: %w", err)
+	}
+
+	return c, nil
+}
+
+func (b *Manager) GetCampaigns(ctx context.Context) ([]*Campaign, error) {
+	campaigns, err := b.bonusProvider.GetCampaigns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get campaigns error: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+func (b *Manager) StopCampaign(ctx context.Context, campaignID string) error {
+	c, err := b.GetCampaign(ctx, campaignID)
+	if err != nil {
+		return err
+	}
+
+	c.Active = false
+
+	return b.UpdateCampaign(ctx, c)
+}
+
+// campaignCredits matches the campaigns running at the processing time.
+func (b *Manager) campaignCredits(ctx context.Context, order *Order, facts *orderFacts) ([]*BonusCredit, error) {
+	campaigns, err := b.bonusProvider.GetActiveCampaigns(ctx, facts.at)
+	if err != nil {
+		return nil, fmt.Errorf("get active campaigns error: %w", err)
+	}
+
+	credits := make([]*BonusCredit, 0, len(campaigns))
+	for _, c := range campaigns {
+		if !c.matches(facts) {
+			continue
+		}
+
+		amount := c.credit(facts.accrual)
+		if amount <= 0 {
+			continue
+		}
+
+		credits = append(credits, &BonusCredit{
+			Kind:       LedgerBonus,
+			UserID:     order.UserID,
+			OrderID:    order.ID,
+			CampaignID: c.ID,
+			Amount:     amount,
+		})
+	}
+
+	return credits, nil
+}
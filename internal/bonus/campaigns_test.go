@@ -0,0 +1,130 @@
+package bonus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCampaignValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		campaign Campaign
+		err      error
+	}{
+		{name: "bonus", campaign: Campaign{Name: "first order", MaxOrders: 1, Bonus: 10000}},
+		{name: "multiplier", campaign: Campaign{Name: "weekend", StartsAt: now, EndsAt: now.Add(48 * time.Hour), Multiplier: 2}},
+		{name: "no name", campaign: Campaign{Bonus: 100}, err: ErrCampaignRule},
+		{name: "no action", campaign: Campaign{Name: "empty", Multiplier: 1}, err: ErrCampaignRule},
+		{name: "low multiplier", campaign: Campaign{Name: "half", Multiplier: 0.5}, err: ErrCampaignRule},
+		{name: "period", campaign: Campaign{Name: "back", StartsAt: now, EndsAt: now, Bonus: 100}, err: ErrCampaignRule},
+		{name: "order count", campaign: Campaign{Name: "count", MinOrders: 3, MaxOrders: 2, Bonus: 100}, err: ErrCampaignRule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.campaign.validate(), tt.err)
+		})
+	}
+}
+
+func TestCampaignMatches(t *testing.T) {
+	start := time.Date(2023, 1, 7, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+
+	weekend := &Campaign{Active: true, StartsAt: start, EndsAt: end, Multiplier: 2}
+	firstOrder := &Campaign{Active: true, MaxOrders: 1, Bonus: 10000}
+	gold := &Campaign{Active: true, Tiers: []string{"Gold"}, MinAccrual: 1000, Bonus: 500}
+
+	tests := []struct {
+		name     string
+		campaign *Campaign
+		facts    orderFacts
+		match    bool
+	}{
+		{name: "weekend", campaign: weekend, facts: orderFacts{at: start.Add(time.Hour)}, match: true},
+		{name: "before weekend", campaign: weekend, facts: orderFacts{at: start.Add(-time.Hour)}},
+		{name: "after weekend", campaign: weekend, facts: orderFacts{at: end}},
+		{name: "first order", campaign: firstOrder, facts: orderFacts{orderCount: 1}, match: true},
+		{name: "second order", campaign: firstOrder, facts: orderFacts{orderCount: 2}},
+		{name: "gold", campaign: gold, facts: orderFacts{tier: "Gold", accrual: 1000}, match: true},
+		{name: "silver", campaign: gold, facts: orderFacts{tier: "Silver", accrual: 1000}},
+		{name: "small accrual", campaign: gold, facts: orderFacts{tier: "Gold", accrual: 999}},
+		{name: "inactive", campaign: &Campaign{Bonus: 100}, facts: orderFacts{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, tt.campaign.matches(&tt.facts))
+		})
+	}
+
+	assert.Equal(t, 1500, weekend.credit(1500))
+	assert.Equal(t, 10000, firstOrder.credit(0))
+	assert.Equal(t, 1250, (&Campaign{Multiplier: 1.5, Bonus: 500}).credit(1500))
+}
+
+func TestSetOrderAccrualCampaigns(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	accrualProvider := new(mockedAccrualProvider)
+	bonusManager := NewManager(bonusProvider, accrualProvider)
+
+	orderID := "79927398713"
+	order := &Order{ID: orderID, UserID: "aaaa-bbbb", CreatedAt: time.Now().Add(-time.Hour)}
+	campaigns := []*Campaign{
+		{ID: "c-1", Active: true, MaxOrders: 1, Bonus: 10000},
+		{ID: "c-2", Active: true, Multiplier: 2},
+		{ID: "c-3", Active: true, Tiers: []string{"Gold"}, Bonus: 500},
+	}
+
+	accrualProvider.On("GetAccrual", mock.Anything, orderID).Return("PROCESSED", 700, nil).Once()
+	bonusProvider.On("AddOrderCheck", mock.Anything, orderID).Return(nil).Once()
+	bonusProvider.On("GetOrder", mock.Anything, orderID).Return(order, nil).Once()
+	bonusProvider.On("GetUserTier", mock.Anything, "aaaa-bbbb").Return("", 0, nil).Once()
+	bonusProvider.On("CountProcessedOrders", mock.Anything, "aaaa-bbbb").Return(0, nil).Once()
+	bonusProvider.On("GetActiveCampaigns", mock.Anything, mock.MatchedBy(func(at time.Time) bool {
+		return at.After(order.CreatedAt)
+	})).Return(campaigns, nil).Once()
+	bonusProvider.On("GetReferral", mock.Anything, "aaaa-bbbb").Return((*Referral)(nil), ErrReferralNotFound).Once()
+	bonusProvider.On("ProcessOrder", mock.Anything, orderID, 700, &OrderRewards{
+		Credits: []*BonusCredit{
+			{Kind: LedgerBonus, UserID: "aaaa-bbbb", OrderID: orderID, CampaignID: "c-1", Amount: 10000},
+			{Kind: LedgerBonus, UserID: "aaaa-bbbb", OrderID: orderID, CampaignID: "c-2", Amount: 700},
+		},
+	}).Return(nil).Once()
+
+	err := bonusManager.SetOrderAccrual(context.Background(), orderID)
+
+	accrualProvider.AssertExpectations(t)
+	bonusProvider.AssertExpectations(t)
+	assert.NoError(t, err)
+}
+
+func TestSetOrderAccrualRewardsError(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	accrualProvider := new(mockedAccrualProvider)
+	bonusManager := NewManager(bonusProvider, accrualProvider)
+
+	orderID := "79927398713"
+	order := &Order{ID: orderID, UserID: "aaaa-bbbb", CreatedAt: time.Now()}
+
+	accrualProvider.On("GetAccrual", mock.Anything, orderID).Return("PROCESSED", 700, nil).Once()
+	bonusProvider.On("AddOrderCheck", mock.Anything, orderID).Return(nil).Once()
+	bonusProvider.On("GetOrder", mock.Anything, orderID).Return(order, nil).Once()
+	bonusProvider.On("GetUserTier", mock.Anything, "aaaa-bbbb").Return("", 0, nil).Once()
+	bonusProvider.On("CountProcessedOrders", mock.Anything, "aaaa-bbbb").Return(0, nil).Once()
+	bonusProvider.On("GetActiveCampaigns", mock.Anything, mock.Anything).
+		Return([]*Campaign(nil), errors.New("test")).Once()
+
+	err := bonusManager.SetOrderAccrual(context.Background(), orderID)
+
+	bonusProvider.AssertExpectations(t)
+	bonusProvider.AssertNotCalled(t, "ProcessOrder", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	assert.ErrorIs(t, err, ErrProcessFailed)
+}
@@ -0,0 +1,115 @@
+package bonus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	HoldActive   = "held"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+)
+
+var (
+	ErrHoldNotFound = errors.New("hold not found")
+	ErrHoldExpired  = errors.New("hold expired")
+)
+
+const DefaultHoldTTL = 15 * time.Minute
+
+type HoldProvider interface {
+	// CreateHold locks the balance like CreateWithdraw does before reserving points.
+	CreateHold(ctx context.Context, h *Hold) error
+	CaptureHold(ctx context.Context, h *Hold) error
+	ReleaseHold(ctx context.Context, h *Hold) error
+	ReleaseExpiredHolds(ctx context.Context, at time.Time) (int, error)
+}
+
+type Hold struct {
+	ID         string
+	UserID     string
+	OrderID    string
+	Amount     int
+	Status     string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	FinishedAt time.Time
+}
+
+func (b *Manager) SetHoldTTL(ttl time.Duration) {
+	b.holdTTL = ttl
+}
+
+func (b *Manager) Hold(ctx context.Context, userID string, order string, sum int) (*Hold, error) {
+	err := checkOrderNumber(order)
+	if err != nil {
+		return nil, err
+	}
+
+	if sum <= 0 {
+		return nil, ErrWrongSum
+	}
+
+	_, err = b.bonusProvider.GetOrder(ctx, order)
+	if err == nil {
+		return nil, ErrOrderExists
+	}
+
+	h := &Hold{
+		UserID:    userID,
+		OrderID:   order,
+		Amount:    sum,
+		Status:    HoldActive,
+		ExpiresAt: time.Now().Add(b.holdTTL),
+	}
+
+	err = b.bonusProvider.CreateHold(ctx, h)
+	if errors.Is(err, ErrOrderExists) || errors.Is(err, ErrNotEnough) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create hold error: %w", err)
+	}
+
+	return h, nil
+}
+
+func (b *Manager) CaptureHold(ctx context.Context, userID, holdID string) (*Hold, error) {
+	h := &Hold{ID: holdID, UserID: userID}
+
+	err := b.bonusProvider.CaptureHold(ctx, h)
+	if errors.Is(err, ErrHoldNotFound) || errors.Is(err, ErrHoldExpired) || errors.Is(err, ErrOrderExists) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("capture hold error: %w", err)
+	}
+
+	return h, nil
+}
+
+func (b *Manager) ReleaseHold(ctx context.Context, userID, holdID string) (*Hold, error) {
+	h := &Hold{ID: holdID, UserID: userID}
+
+	err := b.bonusProvider.ReleaseHold(ctx, h)
+	if errors.Is(err, ErrHoldNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("release hold error: %w", err)
+	}
+
+	return h, nil
+}
+
+func (b *Manager) ReleaseExpiredHolds(ctx context.Context) (int, error) {
+	count, err := b.bonusProvider.ReleaseExpiredHolds(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("release expired holds error: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,86 @@
+package bonus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHold(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+	orderID := "79927398713"
+
+	t.Run("luhn", func(t *testing.T) {
+		_, err := bonusManager.Hold(context.Background(), "aaaa-bbbb", "79927398714", 5000)
+		assert.ErrorIs(t, err, ErrLuhnAlgo)
+	})
+
+	t.Run("wrong sum", func(t *testing.T) {
+		_, err := bonusManager.Hold(context.Background(), "aaaa-bbbb", orderID, 0)
+		assert.ErrorIs(t, err, ErrWrongSum)
+	})
+
+	t.Run("not enough", func(t *testing.T) {
+		bonusProvider.On("GetOrder", mock.Anything, orderID).Return((*Order)(nil), ErrOrderNotFound).Once()
+		bonusProvider.On("CreateHold", mock.Anything, mock.AnythingOfType("*bonus.Hold")).Return(ErrNotEnough).Once()
+
+		_, err := bonusManager.Hold(context.Background(), "aaaa-bbbb", orderID, 5000)
+		bonusProvider.AssertExpectations(t)
+
+		assert.ErrorIs(t, err, ErrNotEnough)
+	})
+
+	t.Run("held", func(t *testing.T) {
+		bonusProvider.On("GetOrder", mock.Anything, orderID).Return((*Order)(nil), ErrOrderNotFound).Once()
+		bonusProvider.On("CreateHold", mock.Anything, mock.MatchedBy(func(h *Hold) bool {
+			return h.UserID == "aaaa-bbbb" && h.OrderID == orderID && h.Amount == 5000 &&
+				h.Status == HoldActive && !h.ExpiresAt.IsZero()
+		})).Return(nil).Once()
+
+		h, err := bonusManager.Hold(context.Background(), "aaaa-bbbb", orderID, 5000)
+		bonusProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Equal(t, HoldActive, h.Status)
+	})
+}
+
+func TestCaptureHold(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+
+	for _, expected := range []error{ErrHoldNotFound, ErrHoldExpired, ErrOrderExists} {
+		bonusProvider.On("CaptureHold", mock.Anything, mock.AnythingOfType("*bonus.Hold")).Return(expected).Once()
+
+		_, err := bonusManager.CaptureHold(context.Background(), "aaaa-bbbb", "hold-id")
+		assert.ErrorIs(t, err, expected)
+	}
+
+	bonusProvider.On("CaptureHold", mock.Anything, mock.MatchedBy(func(h *Hold) bool {
+		return h.ID == "hold-id" && h.UserID == "aaaa-bbbb"
+	})).Return(nil).Once()
+
+	_, err := bonusManager.CaptureHold(context.Background(), "aaaa-bbbb", "hold-id")
+	assert.NoError(t, err)
+
+	bonusProvider.AssertExpectations(t)
+}
+
+func TestReleaseHold(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+
+	bonusProvider.On("ReleaseHold", mock.Anything, mock.AnythingOfType("*bonus.Hold")).Return(ErrHoldNotFound).Once()
+	_, err := bonusManager.ReleaseHold(context.Background(), "aaaa-bbbb", "hold-id")
+	assert.ErrorIs(t, err, ErrHoldNotFound)
+
+	bonusProvider.On("ReleaseExpiredHolds", mock.Anything, mock.AnythingOfType("time.Time")).Return(2, nil).Once()
+	count, err := bonusManager.ReleaseExpiredHolds(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	bonusProvider.AssertExpectations(t)
+}
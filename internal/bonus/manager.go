@@ -4,10 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
-
-	"github.com/ferdypruis/go-luhn"
 )
 
 const (
@@ -25,33 +22,58 @@ var (
 	ErrOrderNotFound   = errors.New("order not found")
 	ErrWrongSum        = errors.New("wrong sum")
 	ErrAccrualNotReady = errors.New("accrual not ready")
+	ErrProcessFailed   = errors.New("processed order not saved")
 )
 
 type BonusProvider interface {
-	CreateOrder(ctx context.Context, userID string, orderID int) (*Order, error)
-	UpdateOrder(ctx context.Context, orderID, accrual int, status string) error
-	GetOrder(ctx context.Context, orderID int) (*Order, error)
+	CreateOrder(ctx context.Context, userID string, orderID string) (*Order, error)
+	CreateOrders(ctx context.Context, userID string, orderIDs []string) (owners map[string]string, err error)
+	UpdateOrder(ctx context.Context, orderID string, accrual int, status string) error
+	ProcessOrder(ctx context.Context, orderID string, accrual int, rewards *OrderRewards) error
+	AddOrderCheck(ctx context.Context, orderID string) error
+	GetOrder(ctx context.Context, orderID string) (*Order, error)
 	GetOrders(ctx context.Context, userID string) ([]*Order, error)
 	GetNotFinalOrders(ctx context.Context) ([]*Order, error)
-	GetBalance(ctx context.Context, userID string) (current, withdrawn int, err error)
-	CreateWithdraw(ctx context.Context, userID string, orderID, sum int) error
+	GetBalance(ctx context.Context, userID string) (current, withdrawn, held int, err error)
+	CreateWithdraw(ctx context.Context, userID string, orderID string, sum int) error
 	GetWithdrawals(ctx context.Context, userID string) ([]*Withdrawal, error)
+	GetDataVersion(ctx context.Context, userID string) (int64, error)
+	LedgerProvider
+	TierProvider
+	CampaignProvider
+	ReferralProvider
+	TransferProvider
+	HoldProvider
+}
+
+type LedgerProvider interface {
+	GetBalanceAt(ctx context.Context, userID string, at time.Time) (int, error)
+	IterateLedger(ctx context.Context, userID string, from, to time.Time, fn func(*LedgerEntry) error) error
 }
 
 type AccrualProvider interface {
-	GetAccrual(ctx context.Context, orderID int) (status string, accrual int, err error)
+	GetAccrual(ctx context.Context, orderID string) (status string, accrual int, err error)
 }
 
 type Order struct {
-	ID        int
+	TenantID  string
+	ID        string
 	UserID    string
 	Status    string
 	Accrual   int
 	CreatedAt time.Time
+	CheckedAt time.Time
+	Attempts  int
+}
+
+// OrderRewards are written together with the order's PROCESSED status.
+type OrderRewards struct {
+	Credits  []*BonusCredit
+	Referral *Referral
 }
 
 type Withdrawal struct {
-	ID        int
+	ID        string
 	UserID    string
 	Sum       int
 	CreatedAt time.Time
@@ -60,18 +82,27 @@ type Withdrawal struct {
 type Manager struct {
 	bonusProvider   BonusProvider
 	accrualProvider AccrualProvider
+	tiers           Tiers
+	referrals       ReferralPolicy
+	transfers       TransferPolicy
+	holdTTL         time.Duration
 }
 
 func NewManager(bp BonusProvider, ap AccrualProvider) *Manager {
 	return &Manager{
 		bonusProvider:   bp,
 		accrualProvider: ap,
+		tiers:           DefaultTiers,
+		referrals:       DefaultReferralPolicy,
+		transfers:       DefaultTransferPolicy,
+		holdTTL:         DefaultHoldTTL,
 	}
 }
 
-func (b *Manager) AddOrder(ctx context.Context, userID string, orderID int) error {
-	if !luhn.Valid(strconv.Itoa(orderID)) {
-		return ErrLuhnAlgo
+func (b *Manager) AddOrder(ctx context.Context, userID string, orderID string) error {
+	err := checkOrderNumber(orderID)
+	if err != nil {
+		return err
 	}
 
 	order, err := b.bonusProvider.CreateOrder(ctx, userID, orderID)
@@ -93,6 +124,72 @@ func (b *Manager) AddOrder(ctx context.Context, userID string, orderID int) erro
 	return ErrOrderExists
 }
 
+func (b *Manager) AddOrders(ctx context.Context, userID string, orderIDs []string) ([]error, error) {
+	results := make([]error, len(orderIDs))
+	seen := make(map[string]struct{}, len(orderIDs))
+	toCreate := make([]string, 0, len(orderIDs))
+
+	for i, orderID := range orderIDs {
+		err := checkOrderNumber(orderID)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+
+		if _, ok := seen[orderID]; ok {
+			continue
+		}
+		seen[orderID] = struct{}{}
+		toCreate = append(toCreate, orderID)
+	}
+
+	if len(toCreate) == 0 {
+		return results, nil
+	}
+
+	owners, err := b.bonusProvider.CreateOrders(ctx, userID, toCreate)
+	if err != nil {
+		return nil, fmt.Errorf("create orders error: %w", err)
+	}
+
+	created := make(map[string]bool, len(toCreate))
+	for i, orderID := range orderIDs {
+		if results[i] != nil {
+			continue
+		}
+
+		owner, exists := owners[orderID]
+		switch {
+		case exists && owner == userID:
+			results[i] = ErrUserHasOrder
+		case exists:
+			results[i] = ErrOrderExists
+		case created[orderID]:
+			results[i] = ErrUserHasOrder
+		default:
+			created[orderID] = true
+		}
+	}
+
+	return results, nil
+}
+
+func (b *Manager) GetOrder(ctx context.Context, userID string, orderID string) (*Order, error) {
+	order, err := b.bonusProvider.GetOrder(ctx, orderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get order error: %w", err)
+	}
+
+	if order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
 func (b *Manager) GetOrders(ctx context.Context, userID string) ([]*Order, error) {
 	orders, err := b.bonusProvider.GetOrders(ctx, userID)
 	if err != nil {
@@ -111,16 +208,31 @@ func (b *Manager) GetNotFinalOrders(ctx context.Context) ([]*Order, error) {
 	return orders, nil
 }
 
-func (b *Manager) SetOrderAccrual(ctx context.Context, orderID int) error {
+func (b *Manager) SetOrderAccrual(ctx context.Context, orderID string) error {
 	status, accrual, err := b.accrualProvider.GetAccrual(ctx, orderID)
+
+	checkErr := b.bonusProvider.AddOrderCheck(ctx, orderID)
+
 	if err != nil {
 		return fmt.Errorf("get accrual error: %w", err)
 	}
 
+	if checkErr != nil {
+		return fmt.Errorf("add order check error: %w", checkErr)
+	}
+
 	if status == registered {
 		status = processing
 	}
 
+	if status == processed {
+		err = b.setOrderProcessed(ctx, orderID, accrual)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrProcessFailed, err)
+		}
+		return nil
+	}
+
 	err = b.bonusProvider.UpdateOrder(ctx, orderID, accrual, status)
 	if err != nil {
 		return fmt.Errorf("update order error: %w", err)
@@ -133,7 +245,7 @@ func (b *Manager) SetOrderAccrual(ctx context.Context, orderID int) error {
 	return nil
 }
 
-func (b *Manager) SetOrderInvalid(ctx context.Context, orderID int) error {
+func (b *Manager) SetOrderInvalid(ctx context.Context, orderID string) error {
 	err := b.bonusProvider.UpdateOrder(ctx, orderID, 0, invalid)
 	if err != nil {
 		return fmt.Errorf("update order error: %w", err)
@@ -142,30 +254,31 @@ func (b *Manager) SetOrderInvalid(ctx context.Context, orderID int) error {
 	return nil
 }
 
-func (b *Manager) GetBalance(ctx context.Context, userID string) (current, withdrawn int, err error) {
-	current, withdrawn, err = b.bonusProvider.GetBalance(ctx, userID)
+func (b *Manager) GetBalance(ctx context.Context, userID string) (current, withdrawn, held int, err error) {
+	current, withdrawn, held, err = b.bonusProvider.GetBalance(ctx, userID)
 	if err != nil {
-		return 0, 0, fmt.Errorf("get balance error: %w", err)
+		return 0, 0, 0, fmt.Errorf("get balance error: %w", err)
 	}
 
-	return current, withdrawn, nil
+	return current, withdrawn, held, nil
 }
 
-func (b *Manager) Withdraw(ctx context.Context, userID string, order int, sum int) error {
-	if !luhn.Valid(strconv.Itoa(order)) {
-		return ErrLuhnAlgo
+func (b *Manager) Withdraw(ctx context.Context, userID string, order string, sum int) error {
+	err := checkOrderNumber(order)
+	if err != nil {
+		return err
 	}
 
 	if sum <= 0 {
 		return ErrWrongSum
 	}
 
-	_, err := b.bonusProvider.GetOrder(ctx, order)
+	_, err = b.bonusProvider.GetOrder(ctx, order)
 	if err == nil {
 		return ErrOrderExists
 	}
 
-	current, _, err := b.bonusProvider.GetBalance(ctx, userID)
+	current, _, _, err := b.bonusProvider.GetBalance(ctx, userID)
 	if err != nil {
 		return fmt.Errorf("get balance error: %w", err)
 	}
@@ -174,8 +287,8 @@ func (b *Manager) Withdraw(ctx context.Context, userID string, order int, sum in
 		return ErrNotEnough
 	}
 
-	err = b.bonusProvider.CreateWithdraw(context.Background(), userID, order, sum)
-	if errors.Is(err, ErrOrderExists) {
+	err = b.bonusProvider.CreateWithdraw(ctx, userID, order, sum)
+	if errors.Is(err, ErrOrderExists) || errors.Is(err, ErrNotEnough) {
 		return err
 	}
 	if err != nil {
@@ -193,3 +306,68 @@ func (b *Manager) GetWithdrawals(ctx context.Context, userID string) ([]*Withdra
 
 	return withdrawals, nil
 }
+
+func (b *Manager) GetDataVersion(ctx context.Context, userID string) (int64, error) {
+	version, err := b.bonusProvider.GetDataVersion(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("get data version error: %w", err)
+	}
+
+	return version, nil
+}
+
+// setOrderProcessed works out the tier, campaign and referral rewards first and
+// has them written in one transaction with the status, so a failure leaves the
+// order unprocessed for the next attempt.
+func (b *Manager) setOrderProcessed(ctx context.Context, orderID string, accrual int) error {
+	order, err := b.bonusProvider.GetOrder(ctx, orderID)
+	if err != nil {
+		return fmt.Errorf("get order error: %w", err)
+	}
+
+	tierStatus, err := b.GetTier(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+
+	orderCount, err := b.bonusProvider.CountProcessedOrders(ctx, order.UserID)
+	if err != nil {
+		return fmt.Errorf("count orders error: %w", err)
+	}
+
+	facts := &orderFacts{
+		at:         time.Now(),
+		orderCount: orderCount + 1,
+		tier:       tierStatus.Tier.Name,
+		accrual:    accrual,
+	}
+
+	rewards := &OrderRewards{}
+
+	if amount := tierStatus.Tier.credit(accrual); amount > 0 {
+		rewards.Credits = append(rewards.Credits, &BonusCredit{
+			Kind:    LedgerTier,
+			UserID:  order.UserID,
+			OrderID: order.ID,
+			Amount:  amount,
+		})
+	}
+
+	credits, err := b.campaignCredits(ctx, order, facts)
+	if err != nil {
+		return err
+	}
+	rewards.Credits = append(rewards.Credits, credits...)
+
+	rewards.Referral, err = b.referralReward(ctx, order, facts)
+	if err != nil {
+		return err
+	}
+
+	err = b.bonusProvider.ProcessOrder(ctx, orderID, accrual, rewards)
+	if err != nil {
+		return fmt.Errorf("process order error: %w", err)
+	}
+
+	return nil
+}
@@ -2,9 +2,11 @@ package bonus
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/ruskiiamov/gophermart/internal/tenant"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -15,21 +17,21 @@ func TestAddOrder(t *testing.T) {
 	bonusManager := NewManager(bonusProvider, accrualProvider)
 
 	t.Run("luhn", func(t *testing.T) {
-		err := bonusManager.AddOrder(context.Background(), "aaa-bbb-ccc", 79927398714)
+		err := bonusManager.AddOrder(context.Background(), "aaa-bbb-ccc", "79927398714")
 		assert.ErrorIs(t, err, ErrLuhnAlgo)
 	})
 
 	tests := []struct {
-		orderID int
+		orderID string
 		dErr    error
 		order   *Order
 		fErr    error
 	}{
 		{
-			orderID: 79927398713,
+			orderID: "79927398713",
 			dErr:    ErrOrderExists,
 			order: &Order{
-				ID:        79927398713,
+				ID:        "79927398713",
 				UserID:    "aaaa-bbbb-cccc-dddd",
 				Status:    "PROCESSED",
 				Accrual:   100,
@@ -38,10 +40,10 @@ func TestAddOrder(t *testing.T) {
 			fErr: ErrUserHasOrder,
 		},
 		{
-			orderID: 79927398713,
+			orderID: "79927398713",
 			dErr:    ErrOrderExists,
 			order: &Order{
-				ID:        79927398713,
+				ID:        "79927398713",
 				UserID:    "nnnnn-llll-eeee-ssss",
 				Status:    "INVALID",
 				CreatedAt: time.Date(2023, 2, 5, 22, 5, 15, 0, time.Local),
@@ -66,7 +68,7 @@ func TestAddOrder(t *testing.T) {
 	}
 
 	t.Run("ok", func(t *testing.T) {
-		orderID := 79927398713
+		orderID := "79927398713"
 		userID := "aaaa-bbbb-cccc-dddd"
 
 		order := &Order{
@@ -86,6 +88,45 @@ func TestAddOrder(t *testing.T) {
 	})
 }
 
+func TestAddOrders(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	accrualProvider := new(mockedAccrualProvider)
+	bonusManager := NewManager(bonusProvider, accrualProvider)
+
+	userID := "aaaa-bbbb-cccc-dddd"
+
+	t.Run("all invalid", func(t *testing.T) {
+		results, err := bonusManager.AddOrders(context.Background(), userID, []string{"79927398714", "12345678900"})
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		assert.ErrorIs(t, results[0], ErrLuhnAlgo)
+		assert.ErrorIs(t, results[1], ErrLuhnAlgo)
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		orderIDs := []string{"79927398713", "79927398714", "12345678903", "9278923470", "79927398713"}
+		owners := map[string]string{
+			"12345678903": userID,
+			"9278923470":  "nnnnn-llll-eeee-ssss",
+		}
+
+		bonusProvider.On("CreateOrders", mock.Anything, userID, []string{"79927398713", "12345678903", "9278923470"}).
+			Return(owners, nil).Once()
+
+		results, err := bonusManager.AddOrders(context.Background(), userID, orderIDs)
+
+		bonusProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.NoError(t, results[0])
+		assert.ErrorIs(t, results[1], ErrLuhnAlgo)
+		assert.ErrorIs(t, results[2], ErrUserHasOrder)
+		assert.ErrorIs(t, results[3], ErrOrderExists)
+		assert.ErrorIs(t, results[4], ErrUserHasOrder)
+	})
+}
+
 func TestGetOrders(t *testing.T) {
 	bonusProvider := new(mockedBonusProvider)
 	accrualProvider := new(mockedAccrualProvider)
@@ -100,7 +141,7 @@ func TestGetOrders(t *testing.T) {
 		{
 			orders: []*Order{
 				{
-					ID:      9278923470,
+					ID:      "9278923470",
 					UserID:  "aaaa-bbbb-cccc-dddd",
 					Status:  "PROCESSED",
 					Accrual: 500,
@@ -110,7 +151,7 @@ func TestGetOrders(t *testing.T) {
 					}(),
 				},
 				{
-					ID:      12345678903,
+					ID:      "12345678903",
 					UserID:  "aaaa-bbbb-cccc-dddd",
 					Status:  "PROCESSING",
 					Accrual: 0,
@@ -120,7 +161,7 @@ func TestGetOrders(t *testing.T) {
 					}(),
 				},
 				{
-					ID:      346436439,
+					ID:      "346436439",
 					UserID:  "aaaa-bbbb-cccc-dddd",
 					Status:  "INVALID",
 					Accrual: 0,
@@ -155,7 +196,7 @@ func TestGetNotFinalOrders(t *testing.T) {
 
 	orders := []*Order{
 		{
-			ID:      12345678903,
+			ID:      "12345678903",
 			UserID:  "aaaa-bbbb-cccc-dddd",
 			Status:  "PROCESSING",
 			Accrual: 0,
@@ -184,28 +225,62 @@ func TestSetOrderAccrual(t *testing.T) {
 	bonusManager := NewManager(bonusProvider, accrualProvider)
 
 	tests := []struct {
-		orderID int
-		status  string
-		accrual int
-		finErr  error
+		orderID   string
+		status    string
+		accrual   int
+		tier      string
+		rolling   int
+		credited  int
+		tierBonus int
+		finErr    error
 	}{
 		{
-			orderID: 9278923470,
-			status:  "PROCESSED",
-			accrual: 500,
-			finErr:  nil,
+			orderID:  "9278923470",
+			status:   "PROCESSED",
+			accrual:  500,
+			credited: 500,
+			finErr:   nil,
+		},
+		{
+			orderID:   "2377225624",
+			status:    "PROCESSED",
+			accrual:   500,
+			tier:      "Gold",
+			rolling:   3000000,
+			credited:  500,
+			tierBonus: 50,
+			finErr:    nil,
 		},
 		{
-			orderID: 12345678903,
-			status:  "PROCESSING",
-			accrual: 0,
-			finErr:  ErrAccrualNotReady,
+			orderID:  "12345678903",
+			status:   "PROCESSING",
+			accrual:  0,
+			credited: 0,
+			finErr:   ErrAccrualNotReady,
 		},
 	}
 	for _, tt := range tests {
 		t.Run("ok", func(t *testing.T) {
 			accrualProvider.On("GetAccrual", mock.Anything, tt.orderID).Return(tt.status, tt.accrual, nil).Once()
-			bonusProvider.On("UpdateOrder", mock.Anything, tt.orderID, tt.accrual, tt.status).Return(nil).Once()
+			bonusProvider.On("AddOrderCheck", mock.Anything, tt.orderID).Return(nil).Once()
+			if tt.status == "PROCESSED" {
+				bonusProvider.On("GetOrder", mock.Anything, tt.orderID).
+					Return(&Order{ID: tt.orderID, UserID: "aaaa-bbbb"}, nil).Once()
+				bonusProvider.On("GetUserTier", mock.Anything, "aaaa-bbbb").Return(tt.tier, tt.rolling, nil).Once()
+				bonusProvider.On("CountProcessedOrders", mock.Anything, "aaaa-bbbb").Return(0, nil).Once()
+				bonusProvider.On("GetActiveCampaigns", mock.Anything, mock.Anything).Return([]*Campaign{}, nil).Once()
+				bonusProvider.On("GetReferral", mock.Anything, "aaaa-bbbb").Return((*Referral)(nil), ErrReferralNotFound).Once()
+
+				rewards := &OrderRewards{}
+				if tt.tierBonus > 0 {
+					rewards.Credits = []*BonusCredit{
+						{Kind: LedgerTier, UserID: "aaaa-bbbb", OrderID: tt.orderID, Amount: tt.tierBonus},
+					}
+				}
+				bonusProvider.On("ProcessOrder", mock.Anything, tt.orderID, tt.credited, rewards).Return(nil).Once()
+			} else {
+				bonusProvider.On("UpdateOrder", mock.Anything, tt.orderID, tt.credited, tt.status).Return(nil).Once()
+			}
 
 			err := bonusManager.SetOrderAccrual(context.Background(), tt.orderID)
 
@@ -215,6 +290,69 @@ func TestSetOrderAccrual(t *testing.T) {
 			assert.ErrorIs(t, err, tt.finErr)
 		})
 	}
+	t.Run("accrual error", func(t *testing.T) {
+		orderID := "79927398713"
+		accrualErr := errors.New("test")
+
+		accrualProvider.On("GetAccrual", mock.Anything, orderID).Return("", 0, accrualErr).Once()
+		bonusProvider.On("AddOrderCheck", mock.Anything, orderID).Return(nil).Once()
+
+		err := bonusManager.SetOrderAccrual(context.Background(), orderID)
+
+		accrualProvider.AssertExpectations(t)
+		bonusProvider.AssertExpectations(t)
+
+		assert.ErrorIs(t, err, accrualErr)
+	})
+}
+
+func TestGetOrder(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	accrualProvider := new(mockedAccrualProvider)
+	bonusManager := NewManager(bonusProvider, accrualProvider)
+
+	userID := "aaaa-bbbb-cccc-dddd"
+	orderID := "79927398713"
+
+	t.Run("not found", func(t *testing.T) {
+		var o *Order
+		bonusProvider.On("GetOrder", mock.Anything, orderID).Return(o, ErrOrderNotFound).Once()
+
+		order, err := bonusManager.GetOrder(context.Background(), userID, orderID)
+
+		bonusProvider.AssertExpectations(t)
+		assert.Nil(t, order)
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("another user", func(t *testing.T) {
+		o := &Order{ID: orderID, UserID: "nnnnn-llll-eeee-ssss", Status: "NEW", CreatedAt: time.Now()}
+		bonusProvider.On("GetOrder", mock.Anything, orderID).Return(o, nil).Once()
+
+		order, err := bonusManager.GetOrder(context.Background(), userID, orderID)
+
+		bonusProvider.AssertExpectations(t)
+		assert.Nil(t, order)
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		o := &Order{
+			ID:        orderID,
+			UserID:    userID,
+			Status:    "PROCESSING",
+			CreatedAt: time.Now().Add(-time.Minute),
+			CheckedAt: time.Now(),
+			Attempts:  2,
+		}
+		bonusProvider.On("GetOrder", mock.Anything, orderID).Return(o, nil).Once()
+
+		order, err := bonusManager.GetOrder(context.Background(), userID, orderID)
+
+		bonusProvider.AssertExpectations(t)
+		assert.NoError(t, err)
+		assert.Equal(t, o, order)
+	})
 }
 
 func TestGetBalance(t *testing.T) {
@@ -226,16 +364,18 @@ func TestGetBalance(t *testing.T) {
 		userID := "aaaa-bbbb-cccc-dddd"
 		current := 50050
 		withdrawn := 4200
+		held := 1000
 
-		bonusProvider.On("GetBalance", mock.Anything, userID).Return(current, withdrawn, nil)
+		bonusProvider.On("GetBalance", mock.Anything, userID).Return(current, withdrawn, held, nil)
 
-		c, w, err := bonusManager.GetBalance(context.Background(), userID)
+		c, w, h, err := bonusManager.GetBalance(context.Background(), userID)
 
 		bonusProvider.AssertExpectations(t)
 
 		assert.NoError(t, err)
 		assert.Equal(t, current, c)
 		assert.Equal(t, withdrawn, w)
+		assert.Equal(t, held, h)
 	})
 }
 
@@ -245,17 +385,17 @@ func TestWithdraw(t *testing.T) {
 	bonusManager := NewManager(bonusProvider, accrualProvider)
 
 	t.Run("luhn", func(t *testing.T) {
-		err := bonusManager.Withdraw(context.Background(), "aaa-bbb-ccc", 79927398714, 5000)
+		err := bonusManager.Withdraw(context.Background(), "aaa-bbb-ccc", "79927398714", 5000)
 		assert.ErrorIs(t, err, ErrLuhnAlgo)
 	})
 
 	t.Run("negative sum", func(t *testing.T) {
-		err := bonusManager.Withdraw(context.Background(), "aaa-bbb-ccc", 79927398713, -5000)
+		err := bonusManager.Withdraw(context.Background(), "aaa-bbb-ccc", "79927398713", -5000)
 		assert.ErrorIs(t, err, ErrWrongSum)
 	})
 
 	t.Run("order exists", func(t *testing.T) {
-		orderID := 79927398713
+		orderID := "79927398713"
 		order := &Order{
 			ID:        orderID,
 			UserID:    "ddd-eee-fff",
@@ -272,11 +412,11 @@ func TestWithdraw(t *testing.T) {
 
 	t.Run("not enough", func(t *testing.T) {
 		var ord *Order
-		orderID := 79927398713
+		orderID := "79927398713"
 		userID := "aaaa-bbbb-cccc-dddd"
 
 		bonusProvider.On("GetOrder", mock.Anything, orderID).Return(ord, ErrOrderNotFound).Once()
-		bonusProvider.On("GetBalance", mock.Anything, userID).Return(50050, 4200, nil).Once()
+		bonusProvider.On("GetBalance", mock.Anything, userID).Return(50050, 4200, 0, nil).Once()
 
 		err := bonusManager.Withdraw(context.Background(), userID, orderID, 70000)
 
@@ -286,12 +426,12 @@ func TestWithdraw(t *testing.T) {
 
 	t.Run("withdraw exists", func(t *testing.T) {
 		var ord *Order
-		orderID := 79927398713
+		orderID := "79927398713"
 		userID := "aaaa-bbbb-cccc-dddd"
 		sum := 40000
 
 		bonusProvider.On("GetOrder", mock.Anything, orderID).Return(ord, ErrOrderNotFound).Once()
-		bonusProvider.On("GetBalance", mock.Anything, userID).Return(50050, 4200, nil).Once()
+		bonusProvider.On("GetBalance", mock.Anything, userID).Return(50050, 4200, 0, nil).Once()
 		bonusProvider.On("CreateWithdraw", mock.Anything, userID, orderID, sum).Return(ErrOrderExists).Once()
 
 		err := bonusManager.Withdraw(context.Background(), userID, orderID, sum)
@@ -302,12 +442,12 @@ func TestWithdraw(t *testing.T) {
 
 	t.Run("ok", func(t *testing.T) {
 		var ord *Order
-		orderID := 79927398713
+		orderID := "79927398713"
 		userID := "aaaa-bbbb-cccc-dddd"
 		sum := 40000
 
 		bonusProvider.On("GetOrder", mock.Anything, orderID).Return(ord, ErrOrderNotFound).Once()
-		bonusProvider.On("GetBalance", mock.Anything, userID).Return(50050, 4200, nil).Once()
+		bonusProvider.On("GetBalance", mock.Anything, userID).Return(50050, 4200, 0, nil).Once()
 		bonusProvider.On("CreateWithdraw", mock.Anything, userID, orderID, sum).Return(nil).Once()
 
 		err := bonusManager.Withdraw(context.Background(), userID, orderID, sum)
@@ -315,6 +455,26 @@ func TestWithdraw(t *testing.T) {
 		bonusProvider.AssertExpectations(t)
 		assert.NoError(t, err)
 	})
+
+	t.Run("keeps tenant", func(t *testing.T) {
+		var ord *Order
+		orderID := "79927398713"
+		userID := "aaaa-bbbb-cccc-dddd"
+		sum := 40000
+		ctx := tenant.NewContext(context.Background(), "acme")
+		withTenant := mock.MatchedBy(func(ctx context.Context) bool {
+			return tenant.FromContext(ctx) == "acme"
+		})
+
+		bonusProvider.On("GetOrder", withTenant, orderID).Return(ord, ErrOrderNotFound).Once()
+		bonusProvider.On("GetBalance", withTenant, userID).Return(50050, 4200, 0, nil).Once()
+		bonusProvider.On("CreateWithdraw", withTenant, userID, orderID, sum).Return(nil).Once()
+
+		err := bonusManager.Withdraw(ctx, userID, orderID, sum)
+
+		bonusProvider.AssertExpectations(t)
+		assert.NoError(t, err)
+	})
 }
 
 func TestGetWithdrawals(t *testing.T) {
@@ -331,13 +491,13 @@ func TestGetWithdrawals(t *testing.T) {
 		{
 			withdrawals: []*Withdrawal{
 				{
-					ID:        2377225624,
+					ID:        "2377225624",
 					UserID:    "aaaa-bbbb-cccc-dddd",
 					Sum:       15200,
 					CreatedAt: time.Now(),
 				},
 				{
-					ID:        2377225615,
+					ID:        "2377225615",
 					UserID:    "aaaa-bbbb-cccc-dddd",
 					Sum:       2800,
 					CreatedAt: time.Now(),
@@ -358,3 +518,18 @@ func TestGetWithdrawals(t *testing.T) {
 		})
 	}
 }
+
+func TestGetDataVersion(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	accrualProvider := new(mockedAccrualProvider)
+	bonusManager := NewManager(bonusProvider, accrualProvider)
+
+	userID := "aaaa-bbbb-cccc-dddd"
+
+	bonusProvider.On("GetDataVersion", mock.Anything, userID).Return(int64(7), nil).Once()
+	version, err := bonusManager.GetDataVersion(context.Background(), userID)
+
+	bonusProvider.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), version)
+}
@@ -0,0 +1,52 @@
+package bonus
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ferdypruis/go-luhn"
+)
+
+const MaxOrderNumberLength = 32
+
+var (
+	ErrOrderNumberFormat = errors.New("order number must contain digits only")
+	ErrOrderNumberLength = errors.New("order number is too long")
+)
+
+// ValidateOrderNumber checks that the order number is a non-zero string of
+// digits. Leading zeros are significant and kept as is.
+func ValidateOrderNumber(number string) error {
+	if number == "" {
+		return ErrOrderNumberFormat
+	}
+
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return ErrOrderNumberFormat
+		}
+	}
+
+	if len(number) > MaxOrderNumberLength {
+		return ErrOrderNumberLength
+	}
+
+	if strings.Trim(number, "0") == "" {
+		return ErrOrderNumberFormat
+	}
+
+	return nil
+}
+
+func checkOrderNumber(number string) error {
+	err := ValidateOrderNumber(number)
+	if err != nil {
+		return err
+	}
+
+	if !luhn.Valid(number) {
+		return ErrLuhnAlgo
+	}
+
+	return nil
+}
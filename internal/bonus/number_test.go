@@ -0,0 +1,32 @@
+package bonus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOrderNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		err    error
+	}{
+		{"12345678903", nil},
+		{"0012345678903", nil},
+		{"4561261212345467" + "4561261212345467", nil},
+		{"", ErrOrderNumberFormat},
+		{"+12345678903", ErrOrderNumberFormat},
+		{"-79927398713", ErrOrderNumberFormat},
+		{" 79927398713", ErrOrderNumberFormat},
+		{"7992e398713", ErrOrderNumberFormat},
+		{"000", ErrOrderNumberFormat},
+		{strings.Repeat("1", MaxOrderNumberLength+1), ErrOrderNumberLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			assert.ErrorIs(t, ValidateOrderNumber(tt.number), tt.err)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package bonus
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	referralCodeLen      = 8
+	referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	referralCodeAttempts = 5
+)
+
+var (
+	ErrReferralCode       = errors.New("wrong referral code")
+	ErrReferralCodeExists = errors.New("referral code exists")
+	ErrReferralNotFound   = errors.New("referral not found")
+)
+
+type ReferralProvider interface {
+	GetReferralCode(ctx context.Context, userID string) (string, error)
+	SetReferralCode(ctx context.Context, userID, code string) error
+	GetUserByReferralCode(ctx context.Context, code string) (userID string, err error)
+	CreateReferral(ctx context.Context, referrerID, refereeID string) error
+	GetReferral(ctx context.Context, refereeID string) (*Referral, error)
+	GetReferrals(ctx context.Context, referrerID string) ([]*Referral, error)
+	CountReferralRewards(ctx context.Context, referrerID string, since time.Time) (int, error)
+}
+
+type Referral struct {
+	ReferrerID     string
+	RefereeID      string
+	RefereeLogin   string
+	CreatedAt      time.Time
+	RewardedAt     time.Time
+	OrderID        string
+	ReferrerReward int
+	RefereeReward  int
+}
+
+// ReferralPolicy limits the rewards a referrer can collect: the referee's first
+// processed order must come within Window after registration, carry at least
+// MinAccrual, and the referrer gets at most MaxRewards per Period.
+type ReferralPolicy struct {
+	ReferrerReward int
+	RefereeReward  int
+	MinAccrual     int
+	Window         time.Duration
+	MaxRewards     int
+	Period         time.Duration
+}
+
+var DefaultReferralPolicy = ReferralPolicy{
+	ReferrerReward: 10000,
+	RefereeReward:  5000,
+	Window:         30 * 24 * time.Hour,
+	MaxRewards:     10,
+	Period:         30 * 24 * time.Hour,
+}
+
+func (b *Manager) SetReferralPolicy(policy ReferralPolicy) {
+	b.referrals = policy
+}
+
+func (b *Manager) GetReferralCode(ctx context.Context, userID string) (string, error) {
+	code, err := b.bonusProvider.GetReferralCode(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("get referral code error: %w", err)
+	}
+	if code != "" {
+		return code, nil
+	}
+
+	for i := 0; i < referralCodeAttempts; i++ {
+		code, err = newReferralCode()
+		if err != nil {
+			return "", err
+		}
+
+		err = b.bonusProvider.SetReferralCode(ctx, userID, code)
+		if errors.Is(err, ErrReferralCodeExists) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("set referral code error: %w", err)
+		}
+
+		return code, nil
+	}
+
+	return "", fmt.Errorf("set referral code error: %w", ErrReferralCodeExists)
+}
+
+func (b *Manager) GetReferrer(ctx context.Context, code string) (string, error) {
+	if len(code) != referralCodeLen {
+		return "", ErrReferralCode
+	}
+
+	referrerID, err := b.bonusProvider.GetUserByReferralCode(ctx, code)
+	if errors.Is(err, ErrReferralCode) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("get referrer error: %w", err)
+	}
+
+	return referrerID, nil
+}
+
+func (b *Manager) AddReferral(ctx context.Context, referrerID, refereeID string) error {
+	if referrerID == refereeID {
+		return ErrReferralCode
+	}
+
+	err := b.bonusProvider.CreateReferral(ctx, referrerID, refereeID)
+	if err != nil {
+		return fmt.Errorf("create referral error: %w", err)
+	}
+
+	return nil
+}
+
+func (b *Manager) GetReferrals(ctx context.Context, referrerID string) ([]*Referral, error) {
+	referrals, err := b.bonusProvider.GetReferrals(ctx, referrerID)
+	if err != nil {
+		return nil, fmt.Errorf("get referrals error: %w", err)
+	}
+
+	return referrals, nil
+}
+
+func (b *Manager) ReferralExpired(r *Referral) bool {
+	return r.RewardedAt.IsZero() && b.referrals.Window > 0 && time.Since(r.CreatedAt) > b.referrals.Window
+}
+
+// referralReward returns the referral to reward with the referee's first
+// processed order, nil when the policy gives nothing.
+func (b *Manager) referralReward(ctx context.Context, order *Order, facts *orderFacts) (*Referral, error) {
+	referral, err := b.bonusProvider.GetReferral(ctx, order.UserID)
+	if errors.Is(err, ErrReferralNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get referral error: %w", err)
+	}
+
+	if !referral.RewardedAt.IsZero() || facts.accrual < b.referrals.MinAccrual || facts.orderCount != 1 {
+		return nil, nil
+	}
+	if b.referrals.Window > 0 && order.CreatedAt.Sub(referral.CreatedAt) > b.referrals.Window {
+		return nil, nil
+	}
+
+	referral.OrderID = order.ID
+	referral.RefereeReward = b.referrals.RefereeReward
+
+	referral.ReferrerReward = b.referrals.ReferrerReward
+	if b.referrals.MaxRewards > 0 {
+		rewards, err := b.bonusProvider.CountReferralRewards(ctx, referral.ReferrerID, facts.at.Add(-b.referrals.Period))
+		if err != nil {
+			return nil, fmt.Errorf("count referral rewards error: %w", err)
+		}
+		if rewards >= b.referrals.MaxRewards {
+			referral.ReferrerReward = 0
+		}
+	}
+
+	return referral, nil
+}
+
+func newReferralCode() (string, error) {
+	raw := make([]byte, referralCodeLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("referral code generation error: %w", err)
+	}
+
+	code := make([]byte, referralCodeLen)
+	for i, b := range raw {
+		code[i] = referralCodeAlphabet[int(b)%len(referralCodeAlphabet)]
+	}
+
+	return string(code), nil
+}
@@ -0,0 +1,136 @@
+package bonus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetReferralCode(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+
+	t.Run("existing", func(t *testing.T) {
+		bonusProvider.On("GetReferralCode", mock.Anything, "aaaa-bbbb").Return("ABCD2345", nil).Once()
+
+		code, err := bonusManager.GetReferralCode(context.Background(), "aaaa-bbbb")
+		bonusProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ABCD2345", code)
+	})
+
+	t.Run("new after collision", func(t *testing.T) {
+		bonusProvider.On("GetReferralCode", mock.Anything, "aaaa-bbbb").Return("", nil).Once()
+		bonusProvider.On("SetReferralCode", mock.Anything, "aaaa-bbbb", mock.AnythingOfType("string")).
+			Return(ErrReferralCodeExists).Once()
+		bonusProvider.On("SetReferralCode", mock.Anything, "aaaa-bbbb", mock.AnythingOfType("string")).
+			Return(nil).Once()
+
+		code, err := bonusManager.GetReferralCode(context.Background(), "aaaa-bbbb")
+		bonusProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Len(t, code, referralCodeLen)
+	})
+}
+
+func TestGetReferrer(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+
+	_, err := bonusManager.GetReferrer(context.Background(), "short")
+	assert.ErrorIs(t, err, ErrReferralCode)
+
+	bonusProvider.On("GetUserByReferralCode", mock.Anything, "ABCD2345").Return("", ErrReferralCode).Once()
+	_, err = bonusManager.GetReferrer(context.Background(), "ABCD2345")
+	assert.ErrorIs(t, err, ErrReferralCode)
+
+	bonusProvider.On("GetUserByReferralCode", mock.Anything, "EFGH6789").Return("aaaa-bbbb", nil).Once()
+	referrerID, err := bonusManager.GetReferrer(context.Background(), "EFGH6789")
+	assert.NoError(t, err)
+	assert.Equal(t, "aaaa-bbbb", referrerID)
+
+	bonusProvider.AssertExpectations(t)
+}
+
+func TestReferralReward(t *testing.T) {
+	now := time.Now()
+	order := &Order{ID: "79927398713", UserID: "referee", CreatedAt: now}
+
+	tests := []struct {
+		name           string
+		referral       *Referral
+		orderCount     int
+		rewards        int
+		referrerReward int
+		rewarded       bool
+	}{
+		{
+			name:           "first order",
+			referral:       &Referral{ReferrerID: "referrer", RefereeID: "referee", CreatedAt: now.Add(-time.Hour)},
+			orderCount:     1,
+			referrerReward: 10000,
+			rewarded:       true,
+		},
+		{
+			name:           "referrer limit reached",
+			referral:       &Referral{ReferrerID: "referrer", RefereeID: "referee", CreatedAt: now.Add(-time.Hour)},
+			orderCount:     1,
+			rewards:        10,
+			referrerReward: 0,
+			rewarded:       true,
+		},
+		{
+			name:       "second order",
+			referral:   &Referral{ReferrerID: "referrer", RefereeID: "referee", CreatedAt: now.Add(-time.Hour)},
+			orderCount: 2,
+		},
+		{
+			name:       "window passed",
+			referral:   &Referral{ReferrerID: "referrer", RefereeID: "referee", CreatedAt: now.Add(-60 * 24 * time.Hour)},
+			orderCount: 1,
+		},
+		{
+			name: "already rewarded",
+			referral: &Referral{
+				ReferrerID: "referrer",
+				RefereeID:  "referee",
+				CreatedAt:  now.Add(-time.Hour),
+				RewardedAt: now,
+			},
+			orderCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bonusProvider := new(mockedBonusProvider)
+			bonusManager := NewManager(bonusProvider, nil)
+
+			bonusProvider.On("GetReferral", mock.Anything, "referee").Return(tt.referral, nil).Once()
+			if tt.rewarded {
+				bonusProvider.On("CountReferralRewards", mock.Anything, "referrer", mock.Anything).
+					Return(tt.rewards, nil).Once()
+			}
+
+			facts := &orderFacts{at: now, orderCount: tt.orderCount, accrual: 500}
+			referral, err := bonusManager.referralReward(context.Background(), order, facts)
+			bonusProvider.AssertExpectations(t)
+
+			if tt.rewarded {
+				require.NotNil(t, referral)
+				assert.Equal(t, order.ID, referral.OrderID)
+				assert.Equal(t, 5000, referral.RefereeReward)
+				assert.Equal(t, tt.referrerReward, referral.ReferrerReward)
+			} else {
+				assert.Nil(t, referral)
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
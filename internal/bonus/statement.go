@@ -0,0 +1,65 @@
+package bonus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	LedgerAccrual     = "accrual"
+	LedgerWithdrawal  = "withdrawal"
+	LedgerBonus       = "bonus"
+	LedgerReferral    = "referral"
+	LedgerTier        = "tier"
+	LedgerTransferIn  = "transfer_in"
+	LedgerTransferOut = "transfer_out"
+)
+
+var ErrWrongPeriod = errors.New("wrong statement period")
+
+type LedgerEntry struct {
+	Type       string
+	OrderID    string
+	CampaignID string
+	Amount     int
+	CreatedAt  time.Time
+}
+
+type StatementSink interface {
+	Opening(balance int) error
+	Entry(entry *LedgerEntry, balance int) error
+	Closing(balance int) error
+}
+
+func (b *Manager) Statement(ctx context.Context, userID string, from, to time.Time, sink StatementSink) error {
+	if !from.Before(to) {
+		return ErrWrongPeriod
+	}
+
+	balance, err := b.bonusProvider.GetBalanceAt(ctx, userID, from)
+	if err != nil {
+		return fmt.Errorf("get opening balance error: %w", err)
+	}
+
+	err = sink.Opening(balance)
+	if err != nil {
+		return fmt.Errorf("write opening error: %w", err)
+	}
+
+	err = b.bonusProvider.IterateLedger(ctx, userID, from, to, func(entry *LedgerEntry) error {
+		balance += entry.Amount
+		return sink.Entry(entry, balance)
+	})
+	if err != nil {
+		return fmt.Errorf("iterate ledger error: %w", err)
+	}
+
+	err = sink.Closing(balance)
+	if err != nil {
+		return fmt.Errorf("write closing error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package bonus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type statementLine struct {
+	entry   *LedgerEntry
+	balance int
+}
+
+type recordingSink struct {
+	opening int
+	lines   []statementLine
+	closing int
+}
+
+func (s *recordingSink) Opening(balance int) error {
+	s.opening = balance
+	return nil
+}
+
+func (s *recordingSink) Entry(entry *LedgerEntry, balance int) error {
+	s.lines = append(s.lines, statementLine{entry: entry, balance: balance})
+	return nil
+}
+
+func (s *recordingSink) Closing(balance int) error {
+	s.closing = balance
+	return nil
+}
+
+func TestStatement(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	accrualProvider := new(mockedAccrualProvider)
+	bonusManager := NewManager(bonusProvider, accrualProvider)
+
+	userID := "aaaa-bbbb-cccc-dddd"
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("wrong period", func(t *testing.T) {
+		err := bonusManager.Statement(context.Background(), userID, to, from, &recordingSink{})
+		assert.ErrorIs(t, err, ErrWrongPeriod)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		entries := []*LedgerEntry{
+			{Type: LedgerAccrual, OrderID: "79927398713", Amount: 50000, CreatedAt: from.Add(time.Hour)},
+			{Type: LedgerWithdrawal, OrderID: "2377225624", Amount: -15200, CreatedAt: from.Add(2 * time.Hour)},
+		}
+
+		bonusProvider.On("GetBalanceAt", mock.Anything, userID, from).Return(1000, nil).Once()
+		bonusProvider.On("IterateLedger", mock.Anything, userID, from, to, mock.Anything).Return(entries, nil).Once()
+
+		sink := &recordingSink{}
+		err := bonusManager.Statement(context.Background(), userID, from, to, sink)
+
+		bonusProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1000, sink.opening)
+		assert.Len(t, sink.lines, 2)
+		assert.Equal(t, 51000, sink.lines[0].balance)
+		assert.Equal(t, 35800, sink.lines[1].balance)
+		assert.Equal(t, 35800, sink.closing)
+	})
+}
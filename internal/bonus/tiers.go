@@ -0,0 +1,164 @@
+package bonus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	baseTier     = "Base"
+	tierPeriodMo = 12
+)
+
+var ErrTiersFormat = errors.New("wrong tiers format")
+
+var DefaultTiers = Tiers{
+	{Name: baseTier, Threshold: 0, Multiplier: 1},
+	{Name: "Silver", Threshold: 500000, Multiplier: 1.05},
+	{Name: "Gold", Threshold: 2000000, Multiplier: 1.1},
+}
+
+type TierProvider interface {
+	GetUserTier(ctx context.Context, userID string) (tier string, rollingAccrual int, err error)
+	SetUserTier(ctx context.Context, userID, tier string, rollingAccrual int) error
+	IterateRollingAccruals(ctx context.Context, since time.Time, fn func(userID string, accrual int) error) error
+}
+
+type Tier struct {
+	Name       string
+	Threshold  int
+	Multiplier float64
+	Bonus      int
+}
+
+// credit is the tier's extra on top of the accrual, it is kept as a separate
+// bonus credit so the order keeps the accrual system's amount.
+func (t *Tier) credit(accrual int) int {
+	if accrual <= 0 {
+		return 0
+	}
+
+	return int(math.Round(float64(accrual)*(t.Multiplier-1))) + t.Bonus
+}
+
+// Tiers are ordered by threshold, the first one starts at zero.
+type Tiers []*Tier
+
+// ParseTiers reads "name:threshold:multiplier[:bonus]" items separated by
+// commas, threshold and bonus in points. A zero threshold base tier is added
+// when missing.
+func ParseTiers(value string) (Tiers, error) {
+	tiers := make(Tiers, 0)
+
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] == "" {
+			return nil, fmt.Errorf("%w: %q", ErrTiersFormat, item)
+		}
+
+		threshold, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrTiersFormat, item)
+		}
+
+		multiplier, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || multiplier < 1 {
+			return nil, fmt.Errorf("%w: %q", ErrTiersFormat, item)
+		}
+
+		var bonus float64
+		if len(parts) == 4 {
+			bonus, err = strconv.ParseFloat(parts[3], 64)
+			if err != nil || bonus < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrTiersFormat, item)
+			}
+		}
+
+		tiers = append(tiers, &Tier{
+			Name:       parts[0],
+			Threshold:  int(math.Round(threshold * 100)),
+			Multiplier: multiplier,
+			Bonus:      int(math.Round(bonus * 100)),
+		})
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].Threshold < tiers[j].Threshold
+	})
+
+	if tiers[0].Threshold > 0 {
+		tiers = append(Tiers{{Name: baseTier, Multiplier: 1}}, tiers...)
+	}
+
+	return tiers, nil
+}
+
+func (ts Tiers) forAccrual(rollingAccrual int) (current, next *Tier) {
+	current = ts[0]
+	for i, t := range ts {
+		if rollingAccrual < t.Threshold {
+			return current, ts[i]
+		}
+		current = t
+	}
+
+	return current, nil
+}
+
+func (ts Tiers) byName(name string) *Tier {
+	for _, t := range ts {
+		if t.Name == name {
+			return t
+		}
+	}
+
+	return nil
+}
+
+type TierStatus struct {
+	Tier           *Tier
+	RollingAccrual int
+	Next           *Tier
+}
+
+func (b *Manager) SetTiers(tiers Tiers) {
+	b.tiers = tiers
+}
+
+func (b *Manager) GetTier(ctx context.Context, userID string) (*TierStatus, error) {
+	name, rollingAccrual, err := b.bonusProvider.GetUserTier(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user tier error: %w", err)
+	}
+
+	status := &TierStatus{RollingAccrual: rollingAccrual}
+	status.Tier, status.Next = b.tiers.forAccrual(rollingAccrual)
+
+	if t := b.tiers.byName(name); t != nil {
+		status.Tier = t
+	}
+
+	return status, nil
+}
+
+func (b *Manager) RecalculateTiers(ctx context.Context) (int, error) {
+	since := time.Now().AddDate(0, -tierPeriodMo, 0)
+
+	var count int
+	err := b.bonusProvider.IterateRollingAccruals(ctx, since, func(userID string, accrual int) error {
+		tier, _ := b.tiers.forAccrual(accrual)
+		count++
+		return b.bonusProvider.SetUserTier(ctx, userID, tier.Name, accrual)
+	})
+	if err != nil {
+		return count, fmt.Errorf("recalculate tiers error: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,87 @@
+package bonus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers("Gold:20000:1.1, Silver:5000:1.05:1.5")
+	assert.NoError(t, err)
+	assert.Len(t, tiers, 3)
+
+	assert.Equal(t, "Base", tiers[0].Name)
+	assert.Equal(t, "Silver", tiers[1].Name)
+	assert.Equal(t, 500000, tiers[1].Threshold)
+	assert.Equal(t, 150, tiers[1].Bonus)
+	assert.Equal(t, "Gold", tiers[2].Name)
+	assert.Equal(t, 1.1, tiers[2].Multiplier)
+
+	for _, value := range []string{"", "Gold", "Gold:x:1.1", "Gold:100:0.5", "Gold:100:1.1:-1", ":100:1.1"} {
+		_, err = ParseTiers(value)
+		assert.ErrorIs(t, err, ErrTiersFormat, value)
+	}
+}
+
+func TestTierCredit(t *testing.T) {
+	tier := &Tier{Multiplier: 1.05, Bonus: 100}
+	assert.Equal(t, 150, tier.credit(1000))
+	assert.Equal(t, 0, tier.credit(0))
+	assert.Equal(t, 0, (&Tier{Multiplier: 1}).credit(1000))
+}
+
+func TestGetTier(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+
+	tests := []struct {
+		name    string
+		stored  string
+		rolling int
+		tier    string
+		next    string
+	}{
+		{name: "new user", rolling: 0, tier: "Base", next: "Silver"},
+		{name: "silver", stored: "Silver", rolling: 700000, tier: "Silver", next: "Gold"},
+		{name: "gold", stored: "Gold", rolling: 2500000, tier: "Gold"},
+		{name: "unknown stored tier", stored: "Platinum", rolling: 600000, tier: "Silver", next: "Gold"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bonusProvider.On("GetUserTier", mock.Anything, "aaaa-bbbb").Return(tt.stored, tt.rolling, nil).Once()
+
+			status, err := bonusManager.GetTier(context.Background(), "aaaa-bbbb")
+			bonusProvider.AssertExpectations(t)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.tier, status.Tier.Name)
+			assert.Equal(t, tt.rolling, status.RollingAccrual)
+			if tt.next == "" {
+				assert.Nil(t, status.Next)
+			} else {
+				assert.Equal(t, tt.next, status.Next.Name)
+			}
+		})
+	}
+}
+
+func TestRecalculateTiers(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+
+	bonusProvider.On("IterateRollingAccruals", mock.Anything, mock.Anything, mock.Anything).
+		Return(map[string]int{"user-1": 100, "user-2": 600000, "user-3": 2000000}, nil).Once()
+	bonusProvider.On("SetUserTier", mock.Anything, "user-1", "Base", 100).Return(nil).Once()
+	bonusProvider.On("SetUserTier", mock.Anything, "user-2", "Silver", 600000).Return(nil).Once()
+	bonusProvider.On("SetUserTier", mock.Anything, "user-3", "Gold", 2000000).Return(nil).Once()
+
+	count, err := bonusManager.RecalculateTiers(context.Background())
+	bonusProvider.AssertExpectations(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
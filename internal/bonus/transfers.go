@@ -0,0 +1,124 @@
+package bonus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	TransferPending   = "pending"
+	TransferCompleted = "completed"
+)
+
+var (
+	ErrTransferNotFound  = errors.New("transfer not found")
+	ErrTransferExpired   = errors.New("transfer expired")
+	ErrTransferLimit     = errors.New("transfer daily limit exceeded")
+	ErrRecipientNotFound = errors.New("recipient not found")
+)
+
+type TransferProvider interface {
+	GetRecipient(ctx context.Context, login string) (userID string, err error)
+	CreateTransfer(ctx context.Context, t *Transfer) error
+	// CompleteTransfer locks the sender like CreateWithdraw does and checks the
+	// balance and the amount sent since the given time before moving points.
+	CompleteTransfer(ctx context.Context, t *Transfer, dailyLimit int, since time.Time) error
+	GetTransfers(ctx context.Context, userID string) ([]*Transfer, error)
+}
+
+type Transfer struct {
+	ID             string
+	SenderID       string
+	SenderLogin    string
+	RecipientID    string
+	RecipientLogin string
+	Amount         int
+	Status         string
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	CompletedAt    time.Time
+}
+
+type TransferPolicy struct {
+	DailyLimit int
+	TTL        time.Duration
+}
+
+var DefaultTransferPolicy = TransferPolicy{
+	DailyLimit: 100000,
+	TTL:        5 * time.Minute,
+}
+
+func (b *Manager) SetTransferPolicy(policy TransferPolicy) {
+	b.transfers = policy
+}
+
+func (b *Manager) CreateTransfer(ctx context.Context, senderID, recipientLogin string, sum int) (*Transfer, error) {
+	if sum <= 0 {
+		return nil, ErrWrongSum
+	}
+	if b.transfers.DailyLimit > 0 && sum > b.transfers.DailyLimit {
+		return nil, ErrTransferLimit
+	}
+
+	recipientID, err := b.bonusProvider.GetRecipient(ctx, recipientLogin)
+	if errors.Is(err, ErrRecipientNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get recipient error: %w", err)
+	}
+	if recipientID == senderID {
+		return nil, ErrRecipientNotFound
+	}
+
+	current, _, _, err := b.bonusProvider.GetBalance(ctx, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("get balance error: %w", err)
+	}
+	if current < sum {
+		return nil, ErrNotEnough
+	}
+
+	t := &Transfer{
+		SenderID:       senderID,
+		RecipientID:    recipientID,
+		RecipientLogin: recipientLogin,
+		Amount:         sum,
+		Status:         TransferPending,
+		ExpiresAt:      time.Now().Add(b.transfers.TTL),
+	}
+
+	err = b.bonusProvider.CreateTransfer(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("create transfer error: %w", err)
+	}
+
+	return t, nil
+}
+
+func (b *Manager) ConfirmTransfer(ctx context.Context, senderID, transferID string) (*Transfer, error) {
+	t := &Transfer{ID: transferID, SenderID: senderID}
+
+	err := b.bonusProvider.CompleteTransfer(ctx, t, b.transfers.DailyLimit, time.Now().Add(-24*time.Hour))
+	if errors.Is(err, ErrTransferNotFound) || errors.Is(err, ErrTransferExpired) ||
+		errors.Is(err, ErrTransferLimit) || errors.Is(err, ErrNotEnough) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("complete transfer error: %w", err)
+	}
+
+	return t, nil
+}
+
+func (b *Manager) GetTransfers(ctx context.Context, userID string) ([]*Transfer, error) {
+	transfers, err := b.bonusProvider.GetTransfers(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get transfers error: %w", err)
+	}
+
+	return transfers, nil
+}
@@ -0,0 +1,90 @@
+package bonus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateTransfer(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+	bonusManager.SetTransferPolicy(TransferPolicy{DailyLimit: 100000, TTL: DefaultTransferPolicy.TTL})
+
+	t.Run("wrong sum", func(t *testing.T) {
+		_, err := bonusManager.CreateTransfer(context.Background(), "sender", "bob", 0)
+		assert.ErrorIs(t, err, ErrWrongSum)
+	})
+
+	t.Run("over limit", func(t *testing.T) {
+		_, err := bonusManager.CreateTransfer(context.Background(), "sender", "bob", 100001)
+		assert.ErrorIs(t, err, ErrTransferLimit)
+	})
+
+	t.Run("unknown recipient", func(t *testing.T) {
+		bonusProvider.On("GetRecipient", mock.Anything, "nobody").Return("", ErrRecipientNotFound).Once()
+
+		_, err := bonusManager.CreateTransfer(context.Background(), "sender", "nobody", 5000)
+		bonusProvider.AssertExpectations(t)
+
+		assert.ErrorIs(t, err, ErrRecipientNotFound)
+	})
+
+	t.Run("self", func(t *testing.T) {
+		bonusProvider.On("GetRecipient", mock.Anything, "alice").Return("sender", nil).Once()
+
+		_, err := bonusManager.CreateTransfer(context.Background(), "sender", "alice", 5000)
+		bonusProvider.AssertExpectations(t)
+
+		assert.ErrorIs(t, err, ErrRecipientNotFound)
+	})
+
+	t.Run("not enough", func(t *testing.T) {
+		bonusProvider.On("GetRecipient", mock.Anything, "bob").Return("recipient", nil).Once()
+		bonusProvider.On("GetBalance", mock.Anything, "sender").Return(4000, 0, 0, nil).Once()
+
+		_, err := bonusManager.CreateTransfer(context.Background(), "sender", "bob", 5000)
+		bonusProvider.AssertExpectations(t)
+
+		assert.ErrorIs(t, err, ErrNotEnough)
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		bonusProvider.On("GetRecipient", mock.Anything, "bob").Return("recipient", nil).Once()
+		bonusProvider.On("GetBalance", mock.Anything, "sender").Return(9000, 0, 0, nil).Once()
+		bonusProvider.On("CreateTransfer", mock.Anything, mock.MatchedBy(func(t *Transfer) bool {
+			return t.SenderID == "sender" && t.RecipientID == "recipient" && t.Amount == 5000 &&
+				t.Status == TransferPending && !t.ExpiresAt.IsZero()
+		})).Return(nil).Once()
+
+		transfer, err := bonusManager.CreateTransfer(context.Background(), "sender", "bob", 5000)
+		bonusProvider.AssertExpectations(t)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "bob", transfer.RecipientLogin)
+	})
+}
+
+func TestConfirmTransfer(t *testing.T) {
+	bonusProvider := new(mockedBonusProvider)
+	bonusManager := NewManager(bonusProvider, nil)
+
+	for _, expected := range []error{ErrTransferNotFound, ErrTransferExpired, ErrTransferLimit, ErrNotEnough} {
+		bonusProvider.On("CompleteTransfer", mock.Anything, mock.AnythingOfType("*bonus.Transfer"),
+			DefaultTransferPolicy.DailyLimit, mock.AnythingOfType("time.Time")).Return(expected).Once()
+
+		_, err := bonusManager.ConfirmTransfer(context.Background(), "sender", "transfer-id")
+		assert.ErrorIs(t, err, expected)
+	}
+
+	bonusProvider.On("CompleteTransfer", mock.Anything, mock.MatchedBy(func(t *Transfer) bool {
+		return t.ID == "transfer-id" && t.SenderID == "sender"
+	}), DefaultTransferPolicy.DailyLimit, mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+	_, err := bonusManager.ConfirmTransfer(context.Background(), "sender", "transfer-id")
+	assert.NoError(t, err)
+
+	bonusProvider.AssertExpectations(t)
+}
@@ -10,16 +10,24 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 	"github.com/ruskiiamov/gophermart/internal/access"
 	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
 )
 
-const source = "file://internal/database/migrations"
+const (
+	source          = "file://internal/database/migrations"
+	uniqueViolation = "23505"
+
+	rollingBatchSize = 1000
+)
 
 type Connection struct {
-	dbpool *pgxpool.Pool
+	dbpool  *pgxpool.Pool
+	replica *replica
 }
 
 func NewConnection(ctx context.Context, dbURI string) (*Connection, error) {
@@ -54,37 +62,42 @@ func (c *Connection) Migrate() error {
 
 func (c *Connection) Close() {
 	c.dbpool.Close()
+	if c.replica != nil {
+		c.replica.pool.Close()
+	}
 }
 
-func (c *Connection) CreateUser(ctx context.Context, login, passHash string) error {
-	var id string
-
-	err := c.dbpool.QueryRow(
+func (c *Connection) CreateUser(ctx context.Context, login, passHash string) (userID string, err error) {
+	err = c.dbpool.QueryRow(
 		ctx,
-		`INSERT INTO users (login, pass_hash) VALUES ($1, $2) 
-		ON CONFLICT (login) DO NOTHING RETURNING id;`,
+		`INSERT INTO users (tenant_id, login, pass_hash) VALUES ($1, $2, $3) 
+		ON CONFLICT (tenant_id, login) DO NOTHING RETURNING id;`,
+		tenant.FromContext(ctx),
 		login,
 		passHash,
-	).Scan(&id)
+	).Scan(&userID)
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		return access.ErrLoginExists
+		return "", access.ErrLoginExists
 	}
 	if err != nil {
-		return fmt.Errorf("insert user error: %w", err)
+		return "", fmt.Errorf("insert user error: %w", err)
 	}
 
-	return nil
+	return userID, nil
 }
 
 func (c *Connection) GetUser(ctx context.Context, login string) (*access.User, error) {
 	u := &access.User{Login: login}
+	var lockedUntil *time.Time
 
 	err := c.dbpool.QueryRow(
 		ctx,
-		`SELECT id, pass_hash FROM users WHERE login = $1;`,
+		`SELECT id, pass_hash, failed_logins, locked_until, token_version FROM users 
+		WHERE tenant_id = $1 AND login = $2 AND deleted_at IS NULL;`,
+		tenant.FromContext(ctx),
 		login,
-	).Scan(&(u.ID), &(u.PassHash))
+	).Scan(&(u.ID), &(u.PassHash), &(u.FailedLogins), &lockedUntil, &(u.TokenVersion))
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, access.ErrLoginNotFound
@@ -93,118 +106,212 @@ func (c *Connection) GetUser(ctx context.Context, login string) (*access.User, e
 		return nil, fmt.Errorf("select user error: %w", err)
 	}
 
+	if lockedUntil != nil {
+		u.LockedUntil = *lockedUntil
+	}
+
 	return u, nil
 }
 
-func (c *Connection) CreateOrder(ctx context.Context, userID string, orderID int) (*bonus.Order, error) {
-	var createdAt time.Time
+func (c *Connection) GetUserByID(ctx context.Context, userID string) (*access.User, error) {
+	u := &access.User{ID: userID}
+	var lockedUntil *time.Time
 
 	err := c.dbpool.QueryRow(
 		ctx,
-		`INSERT INTO orders (id, user_id, status) values ($1, $2, 'NEW') 
-		ON CONFLICT (id) DO NOTHING RETURNING created_at;`,
-		orderID,
+		`SELECT login, pass_hash, failed_logins, locked_until, token_version FROM users 
+		WHERE tenant_id = $1 AND id = $2 AND deleted_at IS NULL;`,
+		tenant.FromContext(ctx),
 		userID,
-	).Scan(&createdAt)
+	).Scan(&(u.Login), &(u.PassHash), &(u.FailedLogins), &lockedUntil, &(u.TokenVersion))
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, bonus.ErrOrderExists
+		return nil, access.ErrUserNotFound
 	}
 	if err != nil {
-		return nil, fmt.Errorf("inser order error: %w", err)
+		return nil, fmt.Errorf("select user error: %w", err)
 	}
 
-	ord := &bonus.Order{
-		ID:        orderID,
-		UserID:    userID,
-		CreatedAt: createdAt,
+	if lockedUntil != nil {
+		u.LockedUntil = *lockedUntil
 	}
 
-	return ord, nil
+	return u, nil
 }
 
-func (c *Connection) UpdateOrder(ctx context.Context, orderID, accrual int, status string) error {
-	row, err := c.dbpool.Query(
+func (c *Connection) ChangePassHash(ctx context.Context, userID, passHash string) (tokenVersion int, err error) {
+	err = c.dbpool.QueryRow(
 		ctx,
-		`UPDATE orders SET accrual = $1, status = $2 WHERE id = $3;`,
-		accrual,
-		status,
-		orderID,
+		`UPDATE users SET pass_hash = $1, token_version = token_version + 1 
+		WHERE id = $2 AND deleted_at IS NULL RETURNING token_version;`,
+		passHash,
+		userID,
+	).Scan(&tokenVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, access.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("update pass hash error: %w", err)
+	}
+
+	return tokenVersion, nil
+}
+
+func (c *Connection) AnonymizeUser(ctx context.Context, userID string) error {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE users SET login = 'deleted-' || id::text, pass_hash = '', 
+		failed_logins = 0, locked_until = NULL, token_version = token_version + 1, deleted_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL;`,
+		userID,
 	)
-	row.Close()
 	if err != nil {
-		return fmt.Errorf("update order error: %w", err)
+		return fmt.Errorf("anonymize user error: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return access.ErrUserNotFound
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL;`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke api keys error: %w", err)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`DELETE FROM linked_identities WHERE user_id = $1;`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("delete linked identities error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Connection) GetOrder(ctx context.Context, orderID int) (*bonus.Order, error) {
-	ord := &bonus.Order{ID: orderID}
-
-	err := c.dbpool.QueryRow(
+func (c *Connection) GetLinkedUser(ctx context.Context, issuer, subject string) (userID string, err error) {
+	err = c.dbpool.QueryRow(
 		ctx,
-		`SELECT user_id, status, accrual, created_at FROM orders WHERE id = $1;`,
-		orderID,
-	).Scan(&(ord.UserID), &(ord.Status), &(ord.Accrual), &(ord.CreatedAt))
+		`SELECT user_id FROM linked_identities WHERE tenant_id = $1 AND issuer = $2 AND subject = $3;`,
+		tenant.FromContext(ctx),
+		issuer,
+		subject,
+	).Scan(&userID)
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, bonus.ErrOrderNotFound
+		return "", access.ErrIdentityNotFound
 	}
 	if err != nil {
-		return nil, fmt.Errorf("select order error: %w", err)
+		return "", fmt.Errorf("select linked identity error: %w", err)
 	}
 
-	return ord, nil
+	return userID, nil
 }
 
-func (c *Connection) GetOrders(ctx context.Context, userID string) ([]*bonus.Order, error) {
-	orders := make([]*bonus.Order, 0)
+func (c *Connection) CreateLinkedUser(ctx context.Context, login, issuer, subject string) (userID string, err error) {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-	rows, err := c.dbpool.Query(
+	tenantID := tenant.FromContext(ctx)
+
+	err = tx.QueryRow(
 		ctx,
-		`SELECT id, status, accrual, created_at FROM orders WHERE user_id = $1;`,
+		`INSERT INTO users (tenant_id, login, pass_hash) VALUES ($1, $2, '') RETURNING id;`,
+		tenantID,
+		login,
+	).Scan(&userID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return "", access.ErrLoginExists
+	}
+	if err != nil {
+		return "", fmt.Errorf("insert user error: %w", err)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO linked_identities (tenant_id, issuer, subject, user_id) VALUES ($1, $2, $3, $4);`,
+		tenantID,
+		issuer,
+		subject,
 		userID,
 	)
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return "", access.ErrIdentityExists
+	}
 	if err != nil {
-		return nil, fmt.Errorf("select orders error: %w", err)
+		return "", fmt.Errorf("insert linked identity error: %w", err)
 	}
 
-	for rows.Next() {
-		ord := &bonus.Order{UserID: userID}
-		err = rows.Scan(&(ord.ID), &(ord.Status), &(ord.Accrual), &(ord.CreatedAt))
-		if err != nil {
-			return nil, fmt.Errorf("row scan error: %w", err)
-		}
-		orders = append(orders, ord)
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", fmt.Errorf("transaction commit error: %w", err)
 	}
 
-	err = rows.Err()
+	return userID, nil
+}
+
+func (c *Connection) CreateAPIKey(ctx context.Context, key *access.APIKey, keyHash string) error {
+	err := c.dbpool.QueryRow(
+		ctx,
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4, $5) 
+		RETURNING id, created_at;`,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		keyHash,
+		key.Scopes,
+	).Scan(&(key.ID), &(key.CreatedAt))
 	if err != nil {
-		return nil, fmt.Errorf("db error: %w", err)
+		return fmt.Errorf("insert api key error: %w", err)
 	}
 
-	return orders, nil
+	return nil
 }
 
-func (c *Connection) GetNotFinalOrders(ctx context.Context) ([]*bonus.Order, error) {
-	orders := make([]*bonus.Order, 0)
+func (c *Connection) GetAPIKeys(ctx context.Context, userID string) ([]*access.APIKey, error) {
+	keys := make([]*access.APIKey, 0)
 
-	rows, err := c.dbpool.Query(
+	rows, err := c.reader().Query(
 		ctx,
-		`SELECT id, user_id, status, created_at FROM orders WHERE status IN ('NEW', 'PROCESSING');`,
+		`SELECT id, name, prefix, scopes, created_at, last_used_at FROM api_keys 
+		WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at;`,
+		userID,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("select orders error: %w", err)
+		return nil, fmt.Errorf("select api keys error: %w", err)
 	}
 
 	for rows.Next() {
-		ord := &bonus.Order{}
-		err = rows.Scan(&(ord.ID), &(ord.UserID), &(ord.Status), &(ord.CreatedAt))
+		key := &access.APIKey{UserID: userID}
+		var lastUsedAt *time.Time
+		err = rows.Scan(&(key.ID), &(key.Name), &(key.Prefix), &(key.Scopes), &(key.CreatedAt), &lastUsedAt)
 		if err != nil {
 			return nil, fmt.Errorf("row scan error: %w", err)
 		}
-		orders = append(orders, ord)
+		if lastUsedAt != nil {
+			key.LastUsedAt = *lastUsedAt
+		}
+		keys = append(keys, key)
 	}
 
 	err = rows.Err()
@@ -212,87 +319,163 @@ func (c *Connection) GetNotFinalOrders(ctx context.Context) ([]*bonus.Order, err
 		return nil, fmt.Errorf("db error: %w", err)
 	}
 
-	return orders, nil
+	return keys, nil
 }
 
-func (c *Connection) GetBalance(ctx context.Context, userID string) (current, withdrawn int, err error) {
-	tx, err := c.dbpool.Begin(ctx)
+func (c *Connection) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	tag, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;`,
+		keyID,
+		userID,
+	)
 	if err != nil {
-		return 0, 0, fmt.Errorf("transaction begin error: %w", err)
+		return fmt.Errorf("revoke api key error: %w", err)
 	}
-	defer tx.Rollback(ctx)
 
-	var accrualSum int
+	if tag.RowsAffected() == 0 {
+		return access.ErrAPIKeyNotFound
+	}
 
-	err = tx.QueryRow(
+	return nil
+}
+
+func (c *Connection) UseAPIKey(ctx context.Context, keyHash string) (*access.APIKey, error) {
+	key := &access.APIKey{}
+
+	err := c.dbpool.QueryRow(
 		ctx,
-		`SELECT COALESCE(sum(accrual), 0) as tmp FROM orders WHERE user_id = $1;`,
+		`UPDATE api_keys SET last_used_at = now() FROM users 
+		WHERE api_keys.key_hash = $1 AND api_keys.revoked_at IS NULL 
+		AND users.id = api_keys.user_id AND users.tenant_id = $2 AND users.deleted_at IS NULL 
+		RETURNING api_keys.id, api_keys.user_id, api_keys.name, api_keys.prefix, api_keys.scopes, 
+		api_keys.created_at, api_keys.last_used_at;`,
+		keyHash,
+		tenant.FromContext(ctx),
+	).Scan(&(key.ID), &(key.UserID), &(key.Name), &(key.Prefix), &(key.Scopes), &(key.CreatedAt), &(key.LastUsedAt))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, access.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update api key error: %w", err)
+	}
+
+	return key, nil
+}
+
+func (c *Connection) UpdatePassHash(ctx context.Context, userID, passHash string) error {
+	_, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE users SET pass_hash = $1 WHERE id = $2;`,
+		passHash,
 		userID,
-	).Scan(&accrualSum)
+	)
 	if err != nil {
-		return 0, 0, fmt.Errorf("select accrual sum error: %w", err)
+		return fmt.Errorf("update pass hash error: %w", err)
 	}
 
-	err = tx.QueryRow(
+	return nil
+}
+
+func (c *Connection) AddLoginFailure(ctx context.Context, userID string) (failedLogins int, err error) {
+	err = c.dbpool.QueryRow(
 		ctx,
-		`SELECT COALESCE(sum(sum), 0) as tmp FROM withdrawals WHERE user_id = $1;`,
+		`UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 RETURNING failed_logins;`,
 		userID,
-	).Scan(&withdrawn)
+	).Scan(&failedLogins)
 	if err != nil {
-		return 0, 0, fmt.Errorf("select withdrawals sum error: %w", err)
+		return 0, fmt.Errorf("update failed logins error: %w", err)
 	}
 
-	err = tx.Commit(ctx)
+	return failedLogins, nil
+}
+
+func (c *Connection) SetLockedUntil(ctx context.Context, userID string, lockedUntil time.Time) error {
+	_, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE users SET locked_until = $1 WHERE id = $2;`,
+		lockedUntil,
+		userID,
+	)
 	if err != nil {
-		return 0, 0, fmt.Errorf("transaction commit error: %w", err)
+		return fmt.Errorf("update locked until error: %w", err)
 	}
 
-	current = accrualSum - withdrawn
+	return nil
+}
+
+func (c *Connection) ResetLoginFailures(ctx context.Context, userID string) error {
+	_, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1;`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("reset failed logins error: %w", err)
+	}
 
-	return current, withdrawn, nil
+	return nil
 }
 
-func (c *Connection) CreateWithdraw(ctx context.Context, userID string, orderID, sum int) error {
+func (c *Connection) CreateOrder(ctx context.Context, userID string, orderID string) (*bonus.Order, error) {
 	var createdAt time.Time
 
 	err := c.dbpool.QueryRow(
 		ctx,
-		`INSERT INTO withdrawals (id, user_id, sum) values ($1, $2, $3) 
-		ON CONFLICT (id) DO NOTHING RETURNING created_at`,
+		`INSERT INTO orders (tenant_id, id, user_id, status) values ($1, $2, $3, 'NEW') 
+		ON CONFLICT (tenant_id, id) DO NOTHING RETURNING created_at;`,
+		tenant.FromContext(ctx),
 		orderID,
 		userID,
-		sum,
 	).Scan(&createdAt)
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		return bonus.ErrOrderExists
+		return nil, bonus.ErrOrderExists
 	}
 	if err != nil {
-		return fmt.Errorf("insert withdrawal error: %w", err)
+		return nil, fmt.Errorf("inser order error: %w", err)
 	}
 
-	return nil
+	ord := &bonus.Order{
+		ID:        orderID,
+		TenantID:  tenant.FromContext(ctx),
+		UserID:    userID,
+		CreatedAt: createdAt,
+	}
+
+	return ord, nil
 }
 
-func (c *Connection) GetWithdrawals(ctx context.Context, userID string) ([]*bonus.Withdrawal, error) {
-	withdrawals := make([]*bonus.Withdrawal, 0)
+func (c *Connection) CreateOrders(ctx context.Context, userID string, orderIDs []string) (map[string]string, error) {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-	rows, err := c.dbpool.Query(
+	tenantID := tenant.FromContext(ctx)
+
+	rows, err := tx.Query(
 		ctx,
-		`SELECT id, sum, created_at FROM withdrawals WHERE user_id = $1`,
+		`INSERT INTO orders (tenant_id, id, user_id, status) SELECT $1, unnest($2::varchar[]), $3, 'NEW' 
+		ON CONFLICT (tenant_id, id) DO NOTHING RETURNING id;`,
+		tenantID,
+		orderIDs,
 		userID,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("")
+		return nil, fmt.Errorf("insert orders error: %w", err)
 	}
 
+	created := make(map[string]struct{}, len(orderIDs))
 	for rows.Next() {
-		wdl := &bonus.Withdrawal{UserID: userID}
-		err = rows.Scan(&(wdl.ID), &(wdl.Sum), &(wdl.CreatedAt))
+		var id string
+		err = rows.Scan(&id)
 		if err != nil {
-			return nil, fmt.Errorf("select withdrawals error: %w", err)
+			return nil, fmt.Errorf("row scan error: %w", err)
 		}
-		withdrawals = append(withdrawals, wdl)
+		created[id] = struct{}{}
 	}
 
 	err = rows.Err()
@@ -300,5 +483,1465 @@ func (c *Connection) GetWithdrawals(ctx context.Context, userID string) ([]*bonu
 		return nil, fmt.Errorf("db error: %w", err)
 	}
 
-	return withdrawals, nil
+	existing := make([]string, 0, len(orderIDs)-len(created))
+	for _, id := range orderIDs {
+		if _, ok := created[id]; !ok {
+			existing = append(existing, id)
+		}
+	}
+
+	owners := make(map[string]string, len(existing))
+
+	if len(existing) > 0 {
+		rows, err = tx.Query(
+			ctx,
+			`SELECT id, user_id FROM orders WHERE tenant_id = $1 AND id = ANY($2::varchar[]);`,
+			tenantID,
+			existing,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("select orders error: %w", err)
+		}
+
+		for rows.Next() {
+			var id, owner string
+			err = rows.Scan(&id, &owner)
+			if err != nil {
+				return nil, fmt.Errorf("row scan error: %w", err)
+			}
+			owners[id] = owner
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, fmt.Errorf("db error: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return owners, nil
+}
+
+func (c *Connection) UpdateOrder(ctx context.Context, orderID string, accrual int, status string) error {
+	row, err := c.dbpool.Query(
+		ctx,
+		`UPDATE orders SET accrual = $1, status = $2::statuses,
+			processed_at = CASE WHEN $2::statuses = 'PROCESSED' THEN now() ELSE processed_at END
+		WHERE tenant_id = $3 AND id = $4;`,
+		accrual,
+		status,
+		tenant.FromContext(ctx),
+		orderID,
+	)
+	row.Close()
+	if err != nil {
+		return fmt.Errorf("update order error: %w", err)
+	}
+
+	return nil
+}
+
+// ProcessOrder writes the PROCESSED status together with the order's rewards.
+// An order that is already processed is left as is.
+func (c *Connection) ProcessOrder(ctx context.Context, orderID string, accrual int, rewards *bonus.OrderRewards) error {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if rewards.Referral != nil {
+		err = lockUsers(ctx, tx, rewards.Referral.RefereeID, rewards.Referral.ReferrerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE orders SET accrual = $1, status = 'PROCESSED', processed_at = now() 
+		WHERE tenant_id = $2 AND id = $3 AND status <> 'PROCESSED';`,
+		accrual,
+		tenant.FromContext(ctx),
+		orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("update order error: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	for _, credit := range rewards.Credits {
+		err = addBonusCredit(ctx, tx, credit)
+		if err != nil {
+			return err
+		}
+	}
+
+	if rewards.Referral != nil {
+		err = rewardReferral(ctx, tx, rewards.Referral)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) AddOrderCheck(ctx context.Context, orderID string) error {
+	_, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE orders SET checked_at = now(), accrual_attempts = accrual_attempts + 1 
+		WHERE tenant_id = $1 AND id = $2;`,
+		tenant.FromContext(ctx),
+		orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("update order check error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) GetOrder(ctx context.Context, orderID string) (*bonus.Order, error) {
+	ord := &bonus.Order{ID: orderID, TenantID: tenant.FromContext(ctx)}
+	var checkedAt *time.Time
+
+	err := c.dbpool.QueryRow(
+		ctx,
+		`SELECT user_id, status, accrual, created_at, checked_at, accrual_attempts FROM orders 
+		WHERE tenant_id = $1 AND id = $2;`,
+		ord.TenantID,
+		orderID,
+	).Scan(&(ord.UserID), &(ord.Status), &(ord.Accrual), &(ord.CreatedAt), &checkedAt, &(ord.Attempts))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, bonus.ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select order error: %w", err)
+	}
+
+	if checkedAt != nil {
+		ord.CheckedAt = *checkedAt
+	}
+
+	return ord, nil
+}
+
+func (c *Connection) GetOrders(ctx context.Context, userID string) ([]*bonus.Order, error) {
+	orders := make([]*bonus.Order, 0)
+
+	rows, err := c.userReader(ctx, userID).Query(
+		ctx,
+		`SELECT id, status, accrual, created_at FROM orders WHERE user_id = $1;`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select orders error: %w", err)
+	}
+
+	for rows.Next() {
+		ord := &bonus.Order{UserID: userID}
+		err = rows.Scan(&(ord.ID), &(ord.Status), &(ord.Accrual), &(ord.CreatedAt))
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: %w", err)
+		}
+		orders = append(orders, ord)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (c *Connection) GetNotFinalOrders(ctx context.Context) ([]*bonus.Order, error) {
+	orders := make([]*bonus.Order, 0)
+
+	rows, err := c.dbpool.Query(
+		ctx,
+		`SELECT tenant_id, id, user_id, status, created_at FROM orders WHERE status IN ('NEW', 'PROCESSING');`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select orders error: %w", err)
+	}
+
+	for rows.Next() {
+		ord := &bonus.Order{}
+		err = rows.Scan(&(ord.TenantID), &(ord.ID), &(ord.UserID), &(ord.Status), &(ord.CreatedAt))
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: %w", err)
+		}
+		orders = append(orders, ord)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (c *Connection) GetBalance(ctx context.Context, userID string) (current, withdrawn, held int, err error) {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var accrualSum int
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(sum(accrual), 0) as tmp FROM orders WHERE user_id = $1;`,
+		userID,
+	).Scan(&accrualSum)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("select accrual sum error: %w", err)
+	}
+
+	var creditSum int
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(sum(amount), 0) as tmp FROM bonus_credits WHERE user_id = $1;`,
+		userID,
+	).Scan(&creditSum)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("select bonus credits sum error: %w", err)
+	}
+
+	var transferSum int
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(sum(CASE WHEN recipient_id = $1 THEN amount ELSE -amount END), 0) as tmp FROM transfers 
+		WHERE (sender_id = $1 OR recipient_id = $1) AND status = $2;`,
+		userID,
+		bonus.TransferCompleted,
+	).Scan(&transferSum)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("select transfers sum error: %w", err)
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(sum(sum), 0) as tmp FROM withdrawals WHERE user_id = $1;`,
+		userID,
+	).Scan(&withdrawn)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("select withdrawals sum error: %w", err)
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(sum(amount), 0) as tmp FROM holds WHERE user_id = $1 AND status = $2 AND expires_at > now();`,
+		userID,
+		bonus.HoldActive,
+	).Scan(&held)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("select holds sum error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	current = accrualSum + creditSum + transferSum - withdrawn - held
+
+	return current, withdrawn, held, nil
+}
+
+func (c *Connection) CreateWithdraw(ctx context.Context, userID string, orderID string, sum int) error {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := lockBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if current < sum {
+		return bonus.ErrNotEnough
+	}
+
+	var createdAt time.Time
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO withdrawals (tenant_id, id, user_id, sum) values ($1, $2, $3, $4) 
+		ON CONFLICT (tenant_id, id) DO NOTHING RETURNING created_at`,
+		tenant.FromContext(ctx),
+		orderID,
+		userID,
+		sum,
+	).Scan(&createdAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return bonus.ErrOrderExists
+	}
+	if err != nil {
+		return fmt.Errorf("insert withdrawal error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+// lockBalance serializes balance changes of the user until the end of tx.
+// lockUsers locks the users in id order. Writes that bump the data version of
+// several users take these locks first, so they can't deadlock each other.
+func lockUsers(ctx context.Context, tx pgx.Tx, userIDs ...string) error {
+	_, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = ANY($1) ORDER BY id FOR UPDATE;`, userIDs)
+	if err != nil {
+		return fmt.Errorf("lock users error: %w", err)
+	}
+
+	return nil
+}
+
+func lockBalance(ctx context.Context, tx pgx.Tx, userID string) (int, error) {
+	_, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE;`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("lock user error: %w", err)
+	}
+
+	var balance int
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT
+			(SELECT COALESCE(sum(accrual), 0) FROM orders WHERE user_id = $1) +
+			(SELECT COALESCE(sum(amount), 0) FROM bonus_credits WHERE user_id = $1) +
+			(SELECT COALESCE(sum(amount), 0) FROM transfers WHERE recipient_id = $1 AND status = $2) -
+			(SELECT COALESCE(sum(amount), 0) FROM transfers WHERE sender_id = $1 AND status = $2) -
+			(SELECT COALESCE(sum(sum), 0) FROM withdrawals WHERE user_id = $1) -
+			(SELECT COALESCE(sum(amount), 0) FROM holds WHERE user_id = $1 AND status = $3 AND expires_at > now());`,
+		userID,
+		bonus.TransferCompleted,
+		bonus.HoldActive,
+	).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("select balance error: %w", err)
+	}
+
+	return balance, nil
+}
+
+func (c *Connection) GetWithdrawals(ctx context.Context, userID string) ([]*bonus.Withdrawal, error) {
+	withdrawals := make([]*bonus.Withdrawal, 0)
+
+	rows, err := c.userReader(ctx, userID).Query(
+		ctx,
+		`SELECT id, sum, created_at FROM withdrawals WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select withdrawals error: %w", err)
+	}
+
+	for rows.Next() {
+		wdl := &bonus.Withdrawal{UserID: userID}
+		err = rows.Scan(&(wdl.ID), &(wdl.Sum), &(wdl.CreatedAt))
+		if err != nil {
+			return nil, fmt.Errorf("select withdrawals error: %w", err)
+		}
+		withdrawals = append(withdrawals, wdl)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return withdrawals, nil
+}
+
+// GetDataVersion reads from the primary, so a client sees its own writes. It
+// also counts active holds that expired but are not released yet: their
+// amount is back in the balance before the release bumps the version.
+func (c *Connection) GetDataVersion(ctx context.Context, userID string) (int64, error) {
+	var version int64
+
+	err := c.dbpool.QueryRow(
+		ctx,
+		`SELECT data_version + (
+			SELECT count(*) FROM holds WHERE user_id = $1 AND status = $2 AND expires_at <= now()
+		) FROM users WHERE id = $1;`,
+		userID,
+		bonus.HoldActive,
+	).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("select data version error: %w", err)
+	}
+
+	return version, nil
+}
+
+func (c *Connection) GetBalanceAt(ctx context.Context, userID string, at time.Time) (int, error) {
+	var balance int
+
+	err := c.reader().QueryRow(
+		ctx,
+		`SELECT
+			(SELECT COALESCE(sum(accrual), 0) FROM orders WHERE user_id = $1 AND processed_at < $2) +
+			(SELECT COALESCE(sum(amount), 0) FROM bonus_credits WHERE user_id = $1 AND created_at < $2) +
+			(SELECT COALESCE(sum(amount), 0) FROM transfers 
+				WHERE recipient_id = $1 AND status = $3 AND completed_at < $2) -
+			(SELECT COALESCE(sum(amount), 0) FROM transfers 
+				WHERE sender_id = $1 AND status = $3 AND completed_at < $2) -
+			(SELECT COALESCE(sum(sum), 0) FROM withdrawals WHERE user_id = $1 AND created_at < $2);`,
+		userID,
+		at,
+		bonus.TransferCompleted,
+	).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("select balance error: %w", err)
+	}
+
+	return balance, nil
+}
+
+func (c *Connection) IterateLedger(
+	ctx context.Context,
+	userID string,
+	from, to time.Time,
+	fn func(*bonus.LedgerEntry) error,
+) error {
+	rows, err := c.reader().Query(
+		ctx,
+		`SELECT type, order_id, campaign_id, amount, created_at FROM (
+			SELECT $4::text AS type, id AS order_id, NULL::text AS campaign_id, accrual AS amount,
+			processed_at AS created_at
+			FROM orders WHERE user_id = $1 AND accrual > 0 AND processed_at >= $2 AND processed_at < $3
+			UNION ALL
+			SELECT $5::text AS type, id AS order_id, NULL::text AS campaign_id, -sum AS amount, created_at
+			FROM withdrawals WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+			UNION ALL
+			SELECT kind::text AS type, order_id, campaign_id::text, amount, created_at
+			FROM bonus_credits WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+			UNION ALL
+			SELECT $6::text AS type, ''::varchar AS order_id, NULL::text AS campaign_id, amount, completed_at AS created_at
+			FROM transfers WHERE recipient_id = $1 AND status = $8 AND completed_at >= $2 AND completed_at < $3
+			UNION ALL
+			SELECT $7::text AS type, ''::varchar AS order_id, NULL::text AS campaign_id, -amount AS amount, 
+			completed_at AS created_at
+			FROM transfers WHERE sender_id = $1 AND status = $8 AND completed_at >= $2 AND completed_at < $3
+		) AS ledger ORDER BY created_at, order_id;`,
+		userID,
+		from,
+		to,
+		bonus.LedgerAccrual,
+		bonus.LedgerWithdrawal,
+		bonus.LedgerTransferIn,
+		bonus.LedgerTransferOut,
+		bonus.TransferCompleted,
+	)
+	if err != nil {
+		return fmt.Errorf("select ledger error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &bonus.LedgerEntry{}
+		var campaignID *string
+		err = rows.Scan(&(entry.Type), &(entry.OrderID), &campaignID, &(entry.Amount), &(entry.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("select ledger error: %w", err)
+		}
+		if campaignID != nil {
+			entry.CampaignID = *campaignID
+		}
+
+		err = fn(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) IterateUsers(ctx context.Context, fn func(userID, login string) error) error {
+	rows, err := c.dbpool.Query(
+		ctx,
+		`SELECT id, login FROM users WHERE tenant_id = $1 AND deleted_at IS NULL ORDER BY login;`,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("select users error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, login string
+		err = rows.Scan(&userID, &login)
+		if err != nil {
+			return fmt.Errorf("select users error: %w", err)
+		}
+
+		err = fn(userID, login)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) GetUserTier(ctx context.Context, userID string) (tier string, rollingAccrual int, err error) {
+	var storedTier *string
+
+	err = c.dbpool.QueryRow(
+		ctx,
+		`SELECT tier, tier_accrual FROM users WHERE id = $1;`,
+		userID,
+	).Scan(&storedTier, &rollingAccrual)
+	if err != nil {
+		return "", 0, fmt.Errorf("select user tier error: %w", err)
+	}
+
+	if storedTier != nil {
+		tier = *storedTier
+	}
+
+	return tier, rollingAccrual, nil
+}
+
+func (c *Connection) SetUserTier(ctx context.Context, userID, tier string, rollingAccrual int) error {
+	_, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE users SET tier = $1, tier_accrual = $2, tier_updated_at = now() WHERE id = $3;`,
+		tier,
+		rollingAccrual,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("update user tier error: %w", err)
+	}
+
+	return nil
+}
+
+// IterateRollingAccruals walks the tenant's users in id order, one batch at a
+// time, so fn can write without a result set held open.
+func (c *Connection) IterateRollingAccruals(
+	ctx context.Context,
+	since time.Time,
+	fn func(userID string, accrual int) error,
+) error {
+	type rollingAccrual struct {
+		userID  string
+		accrual int
+	}
+
+	batch := make([]rollingAccrual, 0, rollingBatchSize)
+	lastID := "00000000-0000-0000-0000-000000000000"
+
+	for {
+		rows, err := c.dbpool.Query(
+			ctx,
+			`SELECT users.id, COALESCE(sum(orders.accrual), 0) FROM (
+				SELECT id FROM users WHERE tenant_id = $1 AND deleted_at IS NULL AND id > $3 
+				ORDER BY id LIMIT $4
+			) AS users 
+			LEFT JOIN orders ON orders.user_id = users.id AND orders.processed_at >= $2 
+			GROUP BY users.id ORDER BY users.id;`,
+			tenant.FromContext(ctx),
+			since,
+			lastID,
+			rollingBatchSize,
+		)
+		if err != nil {
+			return fmt.Errorf("select rolling accruals error: %w", err)
+		}
+
+		batch = batch[:0]
+		for rows.Next() {
+			var r rollingAccrual
+			err = rows.Scan(&(r.userID), &(r.accrual))
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("row scan error: %w", err)
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+
+		err = rows.Err()
+		if err != nil {
+			return fmt.Errorf("db error: %w", err)
+		}
+
+		for _, r := range batch {
+			err = fn(r.userID, r.accrual)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < rollingBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].userID
+	}
+}
+
+func (c *Connection) CreateCampaign(ctx context.Context, cmp *bonus.Campaign) error {
+	err := c.dbpool.QueryRow(
+		ctx,
+		`INSERT INTO campaigns (tenant_id, name, starts_at, ends_at, min_orders, max_orders, tiers, 
+		min_accrual, multiplier, bonus, active) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
+		RETURNING id, created_at;`,
+		tenant.FromContext(ctx),
+		cmp.Name,
+		nullTime(cmp.StartsAt),
+		nullTime(cmp.EndsAt),
+		cmp.MinOrders,
+		cmp.MaxOrders,
+		cmp.Tiers,
+		cmp.MinAccrual,
+		cmp.Multiplier,
+		cmp.Bonus,
+		cmp.Active,
+	).Scan(&(cmp.ID), &(cmp.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("insert campaign error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) UpdateCampaign(ctx context.Context, cmp *bonus.Campaign) error {
+	tag, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE campaigns SET name = $1, starts_at = $2, ends_at = $3, min_orders = $4, max_orders = $5, 
+		tiers = $6, min_accrual = $7, multiplier = $8, bonus = $9, active = $10 
+		WHERE tenant_id = $11 AND id = $12;`,
+		cmp.Name,
+		nullTime(cmp.StartsAt),
+		nullTime(cmp.EndsAt),
+		cmp.MinOrders,
+		cmp.MaxOrders,
+		cmp.Tiers,
+		cmp.MinAccrual,
+		cmp.Multiplier,
+		cmp.Bonus,
+		cmp.Active,
+		tenant.FromContext(ctx),
+		cmp.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update campaign error: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return bonus.ErrCampaignNotFound
+	}
+
+	return nil
+}
+
+const campaignColumns = `id, name, starts_at, ends_at, min_orders, max_orders, tiers, min_accrual, 
+	multiplier, bonus, active, created_at`
+
+func scanCampaign(row pgx.Row) (*bonus.Campaign, error) {
+	cmp := &bonus.Campaign{}
+	var startsAt, endsAt *time.Time
+
+	err := row.Scan(
+		&(cmp.ID),
+		&(cmp.Name),
+		&startsAt,
+		&endsAt,
+		&(cmp.MinOrders),
+		&(cmp.MaxOrders),
+		&(cmp.Tiers),
+		&(cmp.MinAccrual),
+		&(cmp.Multiplier),
+		&(cmp.Bonus),
+		&(cmp.Active),
+		&(cmp.CreatedAt),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if startsAt != nil {
+		cmp.StartsAt = *startsAt
+	}
+	if endsAt != nil {
+		cmp.EndsAt = *endsAt
+	}
+
+	return cmp, nil
+}
+
+func (c *Connection) GetCampaign(ctx context.Context, campaignID string) (*bonus.Campaign, error) {
+	cmp, err := scanCampaign(c.dbpool.QueryRow(
+		ctx,
+		`SELECT `+campaignColumns+` FROM campaigns WHERE tenant_id = $1 AND id = $2;`,
+		tenant.FromContext(ctx),
+		campaignID,
+	))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, bonus.ErrCampaignNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select campaign error: %w", err)
+	}
+
+	return cmp, nil
+}
+
+func (c *Connection) GetCampaigns(ctx context.Context) ([]*bonus.Campaign, error) {
+	return c.queryCampaigns(
+		ctx,
+		c.reader(),
+		`SELECT `+campaignColumns+` FROM campaigns WHERE tenant_id = $1 ORDER BY created_at;`,
+		tenant.FromContext(ctx),
+	)
+}
+
+func (c *Connection) GetActiveCampaigns(ctx context.Context, at time.Time) ([]*bonus.Campaign, error) {
+	return c.queryCampaigns(
+		ctx,
+		c.dbpool,
+		`SELECT `+campaignColumns+` FROM campaigns WHERE tenant_id = $1 AND active 
+		AND (starts_at IS NULL OR starts_at <= $2) AND (ends_at IS NULL OR ends_at > $2) 
+		ORDER BY created_at;`,
+		tenant.FromContext(ctx),
+		at,
+	)
+}
+
+func (c *Connection) queryCampaigns(ctx context.Context, pool *pgxpool.Pool, sql string, args ...any) ([]*bonus.Campaign, error) {
+	campaigns := make([]*bonus.Campaign, 0)
+
+	rows, err := pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select campaigns error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cmp, err := scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: %w", err)
+		}
+		campaigns = append(campaigns, cmp)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+func (c *Connection) CountProcessedOrders(ctx context.Context, userID string) (int, error) {
+	var count int
+
+	err := c.dbpool.QueryRow(
+		ctx,
+		`SELECT count(*) FROM orders WHERE user_id = $1 AND status = 'PROCESSED';`,
+		userID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count orders error: %w", err)
+	}
+
+	return count, nil
+}
+
+func addBonusCredit(ctx context.Context, tx pgx.Tx, credit *bonus.BonusCredit) error {
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO bonus_credits (tenant_id, kind, user_id, order_id, campaign_id, amount) 
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING;`,
+		tenant.FromContext(ctx),
+		credit.Kind,
+		credit.UserID,
+		credit.OrderID,
+		nullString(credit.CampaignID),
+		credit.Amount,
+	)
+	if err != nil {
+		return fmt.Errorf("insert bonus credit error: %w", err)
+	}
+
+	return nil
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+func (c *Connection) GetReferralCode(ctx context.Context, userID string) (string, error) {
+	var code *string
+
+	err := c.dbpool.QueryRow(
+		ctx,
+		`SELECT referral_code FROM users WHERE id = $1;`,
+		userID,
+	).Scan(&code)
+	if err != nil {
+		return "", fmt.Errorf("select referral code error: %w", err)
+	}
+
+	if code == nil {
+		return "", nil
+	}
+
+	return *code, nil
+}
+
+func (c *Connection) SetReferralCode(ctx context.Context, userID, code string) error {
+	_, err := c.dbpool.Exec(
+		ctx,
+		`UPDATE users SET referral_code = $1 WHERE id = $2 AND referral_code IS NULL;`,
+		code,
+		userID,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return bonus.ErrReferralCodeExists
+	}
+	if err != nil {
+		return fmt.Errorf("update referral code error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) GetUserByReferralCode(ctx context.Context, code string) (userID string, err error) {
+	err = c.dbpool.QueryRow(
+		ctx,
+		`SELECT id FROM users WHERE tenant_id = $1 AND referral_code = $2 AND deleted_at IS NULL;`,
+		tenant.FromContext(ctx),
+		code,
+	).Scan(&userID)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", bonus.ErrReferralCode
+	}
+	if err != nil {
+		return "", fmt.Errorf("select referrer error: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (c *Connection) CreateReferral(ctx context.Context, referrerID, refereeID string) error {
+	_, err := c.dbpool.Exec(
+		ctx,
+		`INSERT INTO referrals (referee_id, referrer_id, tenant_id) VALUES ($1, $2, $3) 
+		ON CONFLICT (referee_id) DO NOTHING;`,
+		refereeID,
+		referrerID,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("insert referral error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) GetReferral(ctx context.Context, refereeID string) (*bonus.Referral, error) {
+	r := &bonus.Referral{RefereeID: refereeID}
+	var rewardedAt *time.Time
+
+	err := c.dbpool.QueryRow(
+		ctx,
+		`SELECT referrer_id, created_at, rewarded_at, COALESCE(order_id, ''), referrer_reward, referee_reward 
+		FROM referrals WHERE referee_id = $1;`,
+		refereeID,
+	).Scan(&(r.ReferrerID), &(r.CreatedAt), &rewardedAt, &(r.OrderID), &(r.ReferrerReward), &(r.RefereeReward))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, bonus.ErrReferralNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select referral error: %w", err)
+	}
+
+	if rewardedAt != nil {
+		r.RewardedAt = *rewardedAt
+	}
+
+	return r, nil
+}
+
+func (c *Connection) GetReferrals(ctx context.Context, referrerID string) ([]*bonus.Referral, error) {
+	referrals := make([]*bonus.Referral, 0)
+
+	rows, err := c.reader().Query(
+		ctx,
+		`SELECT referrals.referee_id, users.login, referrals.created_at, referrals.rewarded_at, 
+		COALESCE(referrals.order_id, ''), referrals.referrer_reward, referrals.referee_reward 
+		FROM referrals JOIN users ON users.id = referrals.referee_id 
+		WHERE referrals.referrer_id = $1 ORDER BY referrals.created_at;`,
+		referrerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select referrals error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &bonus.Referral{ReferrerID: referrerID}
+		var rewardedAt *time.Time
+		err = rows.Scan(
+			&(r.RefereeID),
+			&(r.RefereeLogin),
+			&(r.CreatedAt),
+			&rewardedAt,
+			&(r.OrderID),
+			&(r.ReferrerReward),
+			&(r.RefereeReward),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: %w", err)
+		}
+		if rewardedAt != nil {
+			r.RewardedAt = *rewardedAt
+		}
+		referrals = append(referrals, r)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return referrals, nil
+}
+
+func (c *Connection) CountReferralRewards(ctx context.Context, referrerID string, since time.Time) (int, error) {
+	var count int
+
+	err := c.dbpool.QueryRow(
+		ctx,
+		`SELECT count(*) FROM referrals WHERE referrer_id = $1 AND rewarded_at >= $2 AND referrer_reward > 0;`,
+		referrerID,
+		since,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count referral rewards error: %w", err)
+	}
+
+	return count, nil
+}
+
+func rewardReferral(ctx context.Context, tx pgx.Tx, r *bonus.Referral) error {
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE referrals SET rewarded_at = now(), order_id = $1, referrer_reward = $2, referee_reward = $3 
+		WHERE referee_id = $4 AND rewarded_at IS NULL;`,
+		r.OrderID,
+		r.ReferrerReward,
+		r.RefereeReward,
+		r.RefereeID,
+	)
+	if err != nil {
+		return fmt.Errorf("update referral error: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	credits := []struct {
+		userID string
+		amount int
+	}{
+		{userID: r.ReferrerID, amount: r.ReferrerReward},
+		{userID: r.RefereeID, amount: r.RefereeReward},
+	}
+
+	for _, credit := range credits {
+		if credit.amount <= 0 {
+			continue
+		}
+
+		err = addBonusCredit(ctx, tx, &bonus.BonusCredit{
+			Kind:    bonus.LedgerReferral,
+			UserID:  credit.userID,
+			OrderID: r.OrderID,
+			Amount:  credit.amount,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Connection) GetRecipient(ctx context.Context, login string) (userID string, err error) {
+	err = c.dbpool.QueryRow(
+		ctx,
+		`SELECT id FROM users WHERE tenant_id = $1 AND login = $2 AND deleted_at IS NULL;`,
+		tenant.FromContext(ctx),
+		login,
+	).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", bonus.ErrRecipientNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("select recipient error: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (c *Connection) CreateTransfer(ctx context.Context, t *bonus.Transfer) error {
+	err := c.dbpool.QueryRow(
+		ctx,
+		`INSERT INTO transfers (tenant_id, sender_id, recipient_id, amount, status, expires_at) 
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at;`,
+		tenant.FromContext(ctx),
+		t.SenderID,
+		t.RecipientID,
+		t.Amount,
+		t.Status,
+		t.ExpiresAt,
+	).Scan(&(t.ID), &(t.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("insert transfer error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) CompleteTransfer(ctx context.Context, t *bonus.Transfer, dailyLimit int, since time.Time) error {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var recipientID string
+	err = tx.QueryRow(
+		ctx,
+		`SELECT recipient_id FROM transfers WHERE id = $1 AND sender_id = $2 AND tenant_id = $3;`,
+		t.ID,
+		t.SenderID,
+		tenant.FromContext(ctx),
+	).Scan(&recipientID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return bonus.ErrTransferNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("select transfer error: %w", err)
+	}
+
+	err = lockUsers(ctx, tx, t.SenderID, recipientID)
+	if err != nil {
+		return err
+	}
+
+	current, err := lockBalance(ctx, tx, t.SenderID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT t.recipient_id, u.login, t.amount, t.status, t.created_at, t.expires_at FROM transfers t 
+		JOIN users u ON u.id = t.recipient_id 
+		WHERE t.id = $1 AND t.sender_id = $2 AND t.tenant_id = $3;`,
+		t.ID,
+		t.SenderID,
+		tenant.FromContext(ctx),
+	).Scan(&(t.RecipientID), &(t.RecipientLogin), &(t.Amount), &(t.Status), &(t.CreatedAt), &(t.ExpiresAt))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return bonus.ErrTransferNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("select transfer error: %w", err)
+	}
+
+	if t.Status != bonus.TransferPending {
+		return bonus.ErrTransferNotFound
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return bonus.ErrTransferExpired
+	}
+	if current < t.Amount {
+		return bonus.ErrNotEnough
+	}
+
+	if dailyLimit > 0 {
+		var sent int
+		err = tx.QueryRow(
+			ctx,
+			`SELECT COALESCE(sum(amount), 0) FROM transfers WHERE sender_id = $1 AND status = $2 AND completed_at >= $3;`,
+			t.SenderID,
+			bonus.TransferCompleted,
+			since,
+		).Scan(&sent)
+		if err != nil {
+			return fmt.Errorf("select sent transfers error: %w", err)
+		}
+
+		if sent+t.Amount > dailyLimit {
+			return bonus.ErrTransferLimit
+		}
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`UPDATE transfers SET status = $1, completed_at = now() WHERE id = $2 RETURNING status, completed_at;`,
+		bonus.TransferCompleted,
+		t.ID,
+	).Scan(&(t.Status), &(t.CompletedAt))
+	if err != nil {
+		return fmt.Errorf("update transfer error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) GetTransfers(ctx context.Context, userID string) ([]*bonus.Transfer, error) {
+	transfers := make([]*bonus.Transfer, 0)
+
+	rows, err := c.reader().Query(
+		ctx,
+		`SELECT t.id, t.sender_id, s.login, t.recipient_id, r.login, t.amount, t.status, 
+		t.created_at, t.expires_at, t.completed_at FROM transfers t 
+		JOIN users s ON s.id = t.sender_id 
+		JOIN users r ON r.id = t.recipient_id 
+		WHERE (t.sender_id = $1 AND (t.status = $2 OR t.expires_at > now())) 
+		OR (t.recipient_id = $1 AND t.status = $2) 
+		ORDER BY t.created_at;`,
+		userID,
+		bonus.TransferCompleted,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select transfers error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := &bonus.Transfer{}
+		var completedAt *time.Time
+		err = rows.Scan(
+			&(t.ID),
+			&(t.SenderID),
+			&(t.SenderLogin),
+			&(t.RecipientID),
+			&(t.RecipientLogin),
+			&(t.Amount),
+			&(t.Status),
+			&(t.CreatedAt),
+			&(t.ExpiresAt),
+			&completedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: %w", err)
+		}
+		if completedAt != nil {
+			t.CompletedAt = *completedAt
+		}
+		transfers = append(transfers, t)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return transfers, nil
+}
+
+func (c *Connection) CreateHold(ctx context.Context, h *bonus.Hold) error {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := lockBalance(ctx, tx, h.UserID)
+	if err != nil {
+		return err
+	}
+	if current < h.Amount {
+		return bonus.ErrNotEnough
+	}
+
+	tenantID := tenant.FromContext(ctx)
+
+	var withdrawn bool
+	err = tx.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM withdrawals WHERE tenant_id = $1 AND id = $2);`,
+		tenantID,
+		h.OrderID,
+	).Scan(&withdrawn)
+	if err != nil {
+		return fmt.Errorf("select withdrawal error: %w", err)
+	}
+	if withdrawn {
+		return bonus.ErrOrderExists
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE holds SET status = $1, finished_at = now() 
+		WHERE tenant_id = $2 AND order_id = $3 AND status = $4 AND expires_at <= now();`,
+		bonus.HoldReleased,
+		tenantID,
+		h.OrderID,
+		bonus.HoldActive,
+	)
+	if err != nil {
+		return fmt.Errorf("release expired hold error: %w", err)
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO holds (tenant_id, user_id, order_id, amount, status, expires_at) 
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at;`,
+		tenantID,
+		h.UserID,
+		h.OrderID,
+		h.Amount,
+		h.Status,
+		h.ExpiresAt,
+	).Scan(&(h.ID), &(h.CreatedAt))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return bonus.ErrOrderExists
+	}
+	if err != nil {
+		return fmt.Errorf("insert hold error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+func selectHoldForUpdate(ctx context.Context, tx pgx.Tx, h *bonus.Hold) error {
+	var finishedAt *time.Time
+
+	err := tx.QueryRow(
+		ctx,
+		`SELECT order_id, amount, status, created_at, expires_at, finished_at FROM holds 
+		WHERE id = $1 AND user_id = $2 AND tenant_id = $3 FOR UPDATE;`,
+		h.ID,
+		h.UserID,
+		tenant.FromContext(ctx),
+	).Scan(&(h.OrderID), &(h.Amount), &(h.Status), &(h.CreatedAt), &(h.ExpiresAt), &finishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return bonus.ErrHoldNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("select hold error: %w", err)
+	}
+
+	if finishedAt != nil {
+		h.FinishedAt = *finishedAt
+	}
+
+	return nil
+}
+
+func (c *Connection) CaptureHold(ctx context.Context, h *bonus.Hold) error {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = lockBalance(ctx, tx, h.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = selectHoldForUpdate(ctx, tx, h)
+	if err != nil {
+		return err
+	}
+
+	if h.Status == bonus.HoldCaptured {
+		return nil
+	}
+	if h.Status != bonus.HoldActive || !time.Now().Before(h.ExpiresAt) {
+		return bonus.ErrHoldExpired
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`INSERT INTO withdrawals (tenant_id, id, user_id, sum) values ($1, $2, $3, $4) 
+		ON CONFLICT (tenant_id, id) DO NOTHING;`,
+		tenant.FromContext(ctx),
+		h.OrderID,
+		h.UserID,
+		h.Amount,
+	)
+	if err != nil {
+		return fmt.Errorf("insert withdrawal error: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return bonus.ErrOrderExists
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`UPDATE holds SET status = $1, finished_at = now() WHERE id = $2 RETURNING status, finished_at;`,
+		bonus.HoldCaptured,
+		h.ID,
+	).Scan(&(h.Status), &(h.FinishedAt))
+	if err != nil {
+		return fmt.Errorf("update hold error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) ReleaseHold(ctx context.Context, h *bonus.Hold) error {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = lockUsers(ctx, tx, h.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = selectHoldForUpdate(ctx, tx, h)
+	if err != nil {
+		return err
+	}
+
+	if h.Status == bonus.HoldReleased {
+		return nil
+	}
+	if h.Status != bonus.HoldActive {
+		return bonus.ErrHoldNotFound
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`UPDATE holds SET status = $1, finished_at = now() WHERE id = $2 RETURNING status, finished_at;`,
+		bonus.HoldReleased,
+		h.ID,
+	).Scan(&(h.Status), &(h.FinishedAt))
+	if err != nil {
+		return fmt.Errorf("update hold error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) ReleaseExpiredHolds(ctx context.Context, at time.Time) (int, error) {
+	tx, err := c.dbpool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("transaction begin error: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tenantID := tenant.FromContext(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`SELECT id FROM users WHERE id IN (
+			SELECT user_id FROM holds WHERE tenant_id = $1 AND status = $2 AND expires_at <= $3
+		) ORDER BY id FOR UPDATE;`,
+		tenantID,
+		bonus.HoldActive,
+		at,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("lock users error: %w", err)
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE holds SET status = $1, finished_at = now() WHERE tenant_id = $2 AND status = $3 AND expires_at <= $4;`,
+		bonus.HoldReleased,
+		tenantID,
+		bonus.HoldActive,
+		at,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("release expired holds error: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
 }
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+
+ALTER TABLE users DROP COLUMN IF EXISTS failed_logins;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
+
+COMMIT;
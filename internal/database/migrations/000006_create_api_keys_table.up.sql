@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS api_keys(
+   id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+   user_id UUID NOT NULL REFERENCES users(id),
+   name VARCHAR (255) NOT NULL,
+   prefix VARCHAR (32) NOT NULL,
+   key_hash CHAR (64) UNIQUE NOT NULL,
+   scopes TEXT[] NOT NULL,
+   created_at TIMESTAMPTZ DEFAULT now(),
+   last_used_at TIMESTAMPTZ,
+   revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS linked_identities(
+   issuer VARCHAR (255) NOT NULL,
+   subject VARCHAR (255) NOT NULL,
+   user_id UUID NOT NULL REFERENCES users(id),
+   created_at TIMESTAMPTZ DEFAULT now(),
+   PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS linked_identities_user_id_idx ON linked_identities (user_id);
+
+COMMIT;
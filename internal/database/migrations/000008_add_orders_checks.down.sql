@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS accrual_attempts;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS checked_at;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checked_at TIMESTAMPTZ;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS accrual_attempts INT NOT NULL DEFAULT 0;
+
+COMMIT;
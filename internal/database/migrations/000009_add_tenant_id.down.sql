@@ -0,0 +1,27 @@
+BEGIN;
+
+ALTER TABLE linked_identities DROP CONSTRAINT IF EXISTS linked_identities_pkey;
+
+ALTER TABLE linked_identities DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE linked_identities ADD PRIMARY KEY (issuer, subject);
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_pkey;
+
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE withdrawals ADD PRIMARY KEY (id);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_pkey;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE orders ADD PRIMARY KEY (id);
+
+DROP INDEX IF EXISTS users_tenant_login_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE users ADD CONSTRAINT users_login_key UNIQUE (login);
+
+COMMIT;
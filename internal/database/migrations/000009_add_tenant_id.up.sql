@@ -0,0 +1,27 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id VARCHAR (64) NOT NULL DEFAULT 'default';
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_login_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_login_idx ON users (tenant_id, login);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tenant_id VARCHAR (64) NOT NULL DEFAULT 'default';
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_pkey;
+
+ALTER TABLE orders ADD PRIMARY KEY (tenant_id, id);
+
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS tenant_id VARCHAR (64) NOT NULL DEFAULT 'default';
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_pkey;
+
+ALTER TABLE withdrawals ADD PRIMARY KEY (tenant_id, id);
+
+ALTER TABLE linked_identities ADD COLUMN IF NOT EXISTS tenant_id VARCHAR (64) NOT NULL DEFAULT 'default';
+
+ALTER TABLE linked_identities DROP CONSTRAINT IF EXISTS linked_identities_pkey;
+
+ALTER TABLE linked_identities ADD PRIMARY KEY (tenant_id, issuer, subject);
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS orders_user_id_created_at_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tier_updated_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tier_accrual;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tier;
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier VARCHAR (64);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier_accrual INT NOT NULL DEFAULT 0;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier_updated_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS orders_user_id_created_at_idx ON orders (user_id, created_at);
+
+COMMIT;
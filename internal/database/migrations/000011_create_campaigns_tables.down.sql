@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS bonus_credits;
+
+DROP TABLE IF EXISTS campaigns;
+
+COMMIT;
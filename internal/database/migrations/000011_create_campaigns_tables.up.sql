@@ -0,0 +1,34 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS campaigns(
+   id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+   tenant_id VARCHAR (64) NOT NULL DEFAULT 'default',
+   name VARCHAR (255) NOT NULL,
+   starts_at TIMESTAMPTZ,
+   ends_at TIMESTAMPTZ,
+   min_orders INT NOT NULL DEFAULT 0,
+   max_orders INT NOT NULL DEFAULT 0,
+   tiers TEXT[] NOT NULL DEFAULT '{}',
+   min_accrual INT NOT NULL DEFAULT 0,
+   multiplier DOUBLE PRECISION NOT NULL DEFAULT 0,
+   bonus INT NOT NULL DEFAULT 0,
+   active BOOLEAN NOT NULL DEFAULT true,
+   created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS campaigns_tenant_id_idx ON campaigns (tenant_id);
+
+CREATE TABLE IF NOT EXISTS bonus_credits(
+   id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+   tenant_id VARCHAR (64) NOT NULL DEFAULT 'default',
+   user_id UUID NOT NULL REFERENCES users(id),
+   order_id BIGINT NOT NULL,
+   campaign_id UUID NOT NULL REFERENCES campaigns(id),
+   amount INT NOT NULL,
+   created_at TIMESTAMPTZ DEFAULT now(),
+   UNIQUE (tenant_id, campaign_id, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS bonus_credits_user_id_idx ON bonus_credits (user_id);
+
+COMMIT;
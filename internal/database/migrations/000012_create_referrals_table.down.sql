@@ -0,0 +1,15 @@
+BEGIN;
+
+DELETE FROM bonus_credits WHERE kind <> 'bonus';
+
+ALTER TABLE bonus_credits DROP COLUMN IF EXISTS kind;
+
+ALTER TABLE bonus_credits ALTER COLUMN campaign_id SET NOT NULL;
+
+DROP TABLE IF EXISTS referrals;
+
+DROP INDEX IF EXISTS users_tenant_referral_code_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS referral_code;
+
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code VARCHAR (16);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_referral_code_idx ON users (tenant_id, referral_code);
+
+CREATE TABLE IF NOT EXISTS referrals(
+   referee_id UUID PRIMARY KEY REFERENCES users(id),
+   referrer_id UUID NOT NULL REFERENCES users(id),
+   tenant_id VARCHAR (64) NOT NULL DEFAULT 'default',
+   order_id BIGINT,
+   referrer_reward INT NOT NULL DEFAULT 0,
+   referee_reward INT NOT NULL DEFAULT 0,
+   created_at TIMESTAMPTZ DEFAULT now(),
+   rewarded_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS referrals_referrer_id_idx ON referrals (referrer_id);
+
+ALTER TABLE bonus_credits ALTER COLUMN campaign_id DROP NOT NULL;
+
+ALTER TABLE bonus_credits ADD COLUMN IF NOT EXISTS kind VARCHAR (32) NOT NULL DEFAULT 'bonus';
+
+COMMIT;
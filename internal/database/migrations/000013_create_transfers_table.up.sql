@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS transfers(
+   id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+   tenant_id VARCHAR (64) NOT NULL DEFAULT 'default',
+   sender_id UUID NOT NULL REFERENCES users(id),
+   recipient_id UUID NOT NULL REFERENCES users(id),
+   amount INT NOT NULL,
+   status VARCHAR (16) NOT NULL DEFAULT 'pending',
+   created_at TIMESTAMPTZ DEFAULT now(),
+   expires_at TIMESTAMPTZ NOT NULL,
+   completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS transfers_sender_id_idx ON transfers (sender_id);
+
+CREATE INDEX IF NOT EXISTS transfers_recipient_id_idx ON transfers (recipient_id);
+
+COMMIT;
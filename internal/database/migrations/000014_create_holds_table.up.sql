@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS holds(
+   id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+   tenant_id VARCHAR (64) NOT NULL DEFAULT 'default',
+   user_id UUID NOT NULL REFERENCES users(id),
+   order_id BIGINT NOT NULL,
+   amount INT NOT NULL,
+   status VARCHAR (16) NOT NULL DEFAULT 'held',
+   created_at TIMESTAMPTZ DEFAULT now(),
+   expires_at TIMESTAMPTZ NOT NULL,
+   finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS holds_user_id_idx ON holds (user_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS holds_tenant_order_held_idx ON holds (tenant_id, order_id) WHERE status = 'held';
+
+COMMIT;
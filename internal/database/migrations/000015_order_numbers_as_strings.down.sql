@@ -0,0 +1,13 @@
+BEGIN;
+
+ALTER TABLE holds ALTER COLUMN order_id TYPE BIGINT USING order_id::bigint;
+
+ALTER TABLE referrals ALTER COLUMN order_id TYPE BIGINT USING order_id::bigint;
+
+ALTER TABLE bonus_credits ALTER COLUMN order_id TYPE BIGINT USING order_id::bigint;
+
+ALTER TABLE withdrawals ALTER COLUMN id TYPE BIGINT USING id::bigint;
+
+ALTER TABLE orders ALTER COLUMN id TYPE BIGINT USING id::bigint;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+ALTER TABLE orders ALTER COLUMN id TYPE VARCHAR (32) USING id::text;
+
+ALTER TABLE withdrawals ALTER COLUMN id TYPE VARCHAR (32) USING id::text;
+
+ALTER TABLE bonus_credits ALTER COLUMN order_id TYPE VARCHAR (32) USING order_id::text;
+
+ALTER TABLE referrals ALTER COLUMN order_id TYPE VARCHAR (32) USING order_id::text;
+
+ALTER TABLE holds ALTER COLUMN order_id TYPE VARCHAR (32) USING order_id::text;
+
+COMMIT;
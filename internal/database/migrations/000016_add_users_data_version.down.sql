@@ -0,0 +1,23 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS users_tier_data_version ON users;
+
+DROP TRIGGER IF EXISTS transfers_data_version ON transfers;
+
+DROP TRIGGER IF EXISTS holds_data_version ON holds;
+
+DROP TRIGGER IF EXISTS bonus_credits_data_version ON bonus_credits;
+
+DROP TRIGGER IF EXISTS withdrawals_data_version ON withdrawals;
+
+DROP TRIGGER IF EXISTS orders_data_version ON orders;
+
+DROP FUNCTION IF EXISTS bump_tier_data_version();
+
+DROP FUNCTION IF EXISTS bump_transfer_data_version();
+
+DROP FUNCTION IF EXISTS bump_user_data_version();
+
+ALTER TABLE users DROP COLUMN IF EXISTS data_version;
+
+COMMIT;
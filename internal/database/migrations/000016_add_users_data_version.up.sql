@@ -0,0 +1,46 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS data_version BIGINT NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION bump_user_data_version() RETURNS TRIGGER AS $$
+BEGIN
+   UPDATE users SET data_version = data_version + 1 WHERE id = NEW.user_id;
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION bump_transfer_data_version() RETURNS TRIGGER AS $$
+BEGIN
+   UPDATE users SET data_version = data_version + 1 WHERE id IN (NEW.sender_id, NEW.recipient_id);
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION bump_tier_data_version() RETURNS TRIGGER AS $$
+BEGIN
+   IF NEW.tier IS DISTINCT FROM OLD.tier THEN
+      NEW.data_version := NEW.data_version + 1;
+   END IF;
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_data_version AFTER INSERT OR UPDATE ON orders
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+CREATE TRIGGER withdrawals_data_version AFTER INSERT OR UPDATE ON withdrawals
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+CREATE TRIGGER bonus_credits_data_version AFTER INSERT OR UPDATE ON bonus_credits
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+CREATE TRIGGER holds_data_version AFTER INSERT OR UPDATE ON holds
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+CREATE TRIGGER transfers_data_version AFTER INSERT OR UPDATE ON transfers
+   FOR EACH ROW EXECUTE FUNCTION bump_transfer_data_version();
+
+CREATE TRIGGER users_tier_data_version BEFORE UPDATE OF tier ON users
+   FOR EACH ROW EXECUTE FUNCTION bump_tier_data_version();
+
+COMMIT;
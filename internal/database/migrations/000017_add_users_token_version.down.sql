@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMPTZ;
+
+UPDATE users SET tokens_valid_after = now() WHERE token_version > 0;
+
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;
+
+COMMIT;
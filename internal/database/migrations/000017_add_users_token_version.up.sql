@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
+
+UPDATE users SET token_version = 1 WHERE tokens_valid_after IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
+
+COMMIT;
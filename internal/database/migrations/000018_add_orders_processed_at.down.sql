@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS orders_user_id_processed_at_idx;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS processed_at;
+
+COMMIT;
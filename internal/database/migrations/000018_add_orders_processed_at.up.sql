@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS processed_at TIMESTAMPTZ;
+
+UPDATE orders SET processed_at = created_at WHERE status = 'PROCESSED';
+
+CREATE INDEX IF NOT EXISTS orders_user_id_processed_at_idx ON orders (user_id, processed_at);
+
+COMMIT;
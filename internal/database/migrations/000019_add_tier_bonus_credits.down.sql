@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS bonus_credits_tier_order_idx;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+CREATE UNIQUE INDEX IF NOT EXISTS bonus_credits_tier_order_idx ON bonus_credits (tenant_id, order_id) 
+WHERE kind = 'tier';
+
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS holds_update_data_version ON holds;
+
+DROP TRIGGER IF EXISTS holds_data_version ON holds;
+
+CREATE TRIGGER holds_data_version AFTER INSERT OR UPDATE ON holds
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+DROP TRIGGER IF EXISTS orders_update_data_version ON orders;
+
+DROP TRIGGER IF EXISTS orders_data_version ON orders;
+
+CREATE TRIGGER orders_data_version AFTER INSERT OR UPDATE ON orders
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+CREATE OR REPLACE FUNCTION bump_transfer_data_version() RETURNS TRIGGER AS $$
+BEGIN
+   UPDATE users SET data_version = data_version + 1 WHERE id IN (NEW.sender_id, NEW.recipient_id);
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+
+CREATE OR REPLACE FUNCTION bump_transfer_data_version() RETURNS TRIGGER AS $$
+BEGIN
+   UPDATE users SET data_version = data_version + 1 WHERE id IN (
+      SELECT id FROM users WHERE id IN (NEW.sender_id, NEW.recipient_id) ORDER BY id FOR UPDATE
+   );
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders_data_version ON orders;
+
+CREATE TRIGGER orders_data_version AFTER INSERT ON orders
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+CREATE TRIGGER orders_update_data_version AFTER UPDATE OF status, accrual ON orders
+   FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status OR OLD.accrual IS DISTINCT FROM NEW.accrual)
+   EXECUTE FUNCTION bump_user_data_version();
+
+DROP TRIGGER IF EXISTS holds_data_version ON holds;
+
+CREATE TRIGGER holds_data_version AFTER INSERT ON holds
+   FOR EACH ROW EXECUTE FUNCTION bump_user_data_version();
+
+CREATE TRIGGER holds_update_data_version AFTER UPDATE OF status ON holds
+   FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status)
+   EXECUTE FUNCTION bump_user_data_version();
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE OR REPLACE FUNCTION bump_tier_data_version() RETURNS TRIGGER AS $$
+BEGIN
+   IF NEW.tier IS DISTINCT FROM OLD.tier OR NEW.tier_accrual IS DISTINCT FROM OLD.tier_accrual THEN
+      NEW.data_version := NEW.data_version + 1;
+   END IF;
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_tier_data_version ON users;
+
+CREATE TRIGGER users_tier_data_version BEFORE UPDATE OF tier, tier_accrual ON users
+   FOR EACH ROW EXECUTE FUNCTION bump_tier_data_version();
+
+COMMIT;
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// replica is a read-only standby used for listing queries while its
+// replication lag stays under maxLag.
+type replica struct {
+	pool    *pgxpool.Pool
+	maxLag  time.Duration
+	healthy atomic.Bool
+}
+
+// SetReplica routes listing queries to the standby at replicaURI. Until a lag
+// check passes, and whenever one fails, they go to the primary.
+func (c *Connection) SetReplica(ctx context.Context, replicaURI string, maxLag time.Duration) error {
+	pool, err := pgxpool.New(ctx, replicaURI)
+	if err != nil {
+		return fmt.Errorf("replica pool creation error: %w", err)
+	}
+
+	c.replica = &replica{pool: pool, maxLag: maxLag}
+	c.checkReplica(ctx)
+	if !c.replica.healthy.Load() {
+		log.Warn().Msg("replica is not ready, reading from primary")
+	}
+
+	return nil
+}
+
+// WatchReplica checks the replica lag every interval.
+func (c *Connection) WatchReplica(ctx context.Context, interval time.Duration) {
+	if c.replica == nil || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkReplica(ctx)
+		}
+	}
+}
+
+// reader returns the pool for queries that may see slightly stale data.
+func (c *Connection) reader() *pgxpool.Pool {
+	if c.replica != nil && c.replica.healthy.Load() {
+		return c.replica.pool
+	}
+
+	return c.dbpool
+}
+
+// userReader returns the replica only when it has replayed every change of the
+// user, so a listing is never older than the data version its ETag is built
+// from.
+func (c *Connection) userReader(ctx context.Context, userID string) *pgxpool.Pool {
+	pool := c.reader()
+	if pool == c.dbpool {
+		return pool
+	}
+
+	var primaryVersion, replicaVersion int64
+	err := c.dbpool.QueryRow(ctx, `SELECT data_version FROM users WHERE id = $1;`, userID).Scan(&primaryVersion)
+	if err == nil {
+		err = pool.QueryRow(ctx, `SELECT data_version FROM users WHERE id = $1;`, userID).Scan(&replicaVersion)
+	}
+	if err != nil || replicaVersion < primaryVersion {
+		return c.dbpool
+	}
+
+	return pool
+}
+
+func (c *Connection) checkReplica(ctx context.Context) {
+	lag, err := c.replicaLag(ctx)
+
+	healthy := err == nil && lag <= c.replica.maxLag
+	if c.replica.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	switch {
+	case err != nil:
+		log.Warn().Err(err).Msg("replica check failed, reading from primary")
+	case !healthy:
+		log.Warn().Dur("lag", lag).Msg("replica lags behind, reading from primary")
+	default:
+		log.Info().Dur("lag", lag).Msg("replica caught up, reading from replica")
+	}
+}
+
+// replicaLag is zero when the standby replayed the primary's current WAL
+// position, otherwise the age of its last replayed transaction. Comparing with
+// the primary catches a standby that lost its connection and has nothing
+// left to replay.
+func (c *Connection) replicaLag(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	var primaryLSN string
+	err := c.dbpool.QueryRow(ctx, `SELECT pg_current_wal_lsn()::text;`).Scan(&primaryLSN)
+	if err != nil {
+		return 0, fmt.Errorf("select primary wal position error: %w", err)
+	}
+
+	var seconds float64
+	err = c.replica.pool.QueryRow(
+		ctx,
+		`SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_replay_lsn() >= $1::pg_lsn THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::float8, 'Infinity')
+		END;`,
+		primaryLSN,
+	).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("select replica lag error: %w", err)
+	}
+
+	if math.IsInf(seconds, 1) || seconds > math.MaxInt64/float64(time.Second) {
+		return time.Duration(math.MaxInt64), nil
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
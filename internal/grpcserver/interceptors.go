@@ -0,0 +1,131 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/access"
+	"github.com/ruskiiamov/gophermart/internal/logger"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func tenantInterceptor(registry *tenant.Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		t, err := registry.Resolve(firstMetadata(ctx, tenantMetadata), firstMetadata(ctx, authorityMetadata))
+		if err != nil {
+			return nil, status.Error(codes.NotFound, "unknown tenant")
+		}
+
+		return handler(tenant.NewContext(ctx, t.ID), req)
+	}
+}
+
+func authInterceptor(accessManager *access.Manager) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := publicMethods[info.FullMethod]; ok {
+			return handler(ctx, req)
+		}
+
+		scope, ok := methodScopes[info.FullMethod]
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "method not allowed")
+		}
+
+		accessToken := firstMetadata(ctx, authMetadata)
+		if accessToken == "" {
+			return nil, status.Error(codes.Unauthenticated, "access token required")
+		}
+
+		authCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		if access.IsAPIKey(accessToken) {
+			userID, scopes, err := accessManager.AuthByAPIKey(authCtx, accessToken)
+			if errors.Is(err, access.ErrAPIKeyNotValid) {
+				return nil, status.Error(codes.Unauthenticated, "api key not valid")
+			}
+			if err != nil {
+				logger.Error(fmt.Sprintf("auth by api key error: %s", err))
+				return nil, status.Error(codes.Internal, "internal error")
+			}
+
+			if !hasScope(scopes, scope) {
+				return nil, status.Error(codes.PermissionDenied, "api key scope required: "+scope)
+			}
+
+			ctx = context.WithValue(ctx, userIDKey, userID)
+			ctx = context.WithValue(ctx, scopesKey, scopes)
+			return handler(ctx, req)
+		}
+
+		userID, err := accessManager.AuthByToken(authCtx, accessToken)
+		if errors.Is(err, access.ErrTokenNotValid) {
+			return nil, status.Error(codes.Unauthenticated, "access token not valid")
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("auth by token error: %s", err))
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+
+		return handler(context.WithValue(ctx, userIDKey, userID), req)
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func tooManyRequests(ctx context.Context, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(retryAfterMetadata, strconv.Itoa(seconds)))
+
+	return status.Error(codes.ResourceExhausted, "too many requests")
+}
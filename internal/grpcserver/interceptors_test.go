@@ -0,0 +1,152 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/access"
+	"github.com/ruskiiamov/gophermart/internal/grpcserver/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testUserID   = "aaaa-bbbb"
+	testLogin    = "user"
+	testPassword = "password1"
+)
+
+// userStub keeps one user and the API keys created for it.
+type userStub struct {
+	access.UserProvider
+	user *access.User
+	keys map[string]*access.APIKey
+}
+
+func newUserStub(t *testing.T) *userStub {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return &userStub{
+		user: &access.User{ID: testUserID, Login: testLogin, PassHash: string(hash)},
+		keys: make(map[string]*access.APIKey),
+	}
+}
+
+func (s *userStub) GetUser(ctx context.Context, login string) (*access.User, error) {
+	if login != s.user.Login {
+		return nil, access.ErrLoginNotFound
+	}
+	return s.user, nil
+}
+
+func (s *userStub) GetUserByID(ctx context.Context, userID string) (*access.User, error) {
+	if userID != s.user.ID {
+		return nil, access.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *userStub) CreateAPIKey(ctx context.Context, key *access.APIKey, keyHash string) error {
+	s.keys[keyHash] = key
+	return nil
+}
+
+func (s *userStub) UseAPIKey(ctx context.Context, keyHash string) (*access.APIKey, error) {
+	key, ok := s.keys[keyHash]
+	if !ok {
+		return nil, access.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *userStub) AddLoginFailure(ctx context.Context, userID string) (int, error) {
+	s.user.FailedLogins++
+	return s.user.FailedLogins, nil
+}
+
+func (s *userStub) SetLockedUntil(ctx context.Context, userID string, lockedUntil time.Time) error {
+	s.user.LockedUntil = lockedUntil
+	return nil
+}
+
+func (s *userStub) ResetLoginFailures(ctx context.Context, userID string) error {
+	s.user.FailedLogins = 0
+	return nil
+}
+
+func newTestAccessManager(t *testing.T, users *userStub) *access.Manager {
+	keys, err := access.SecretKeySet("test secret")
+	require.NoError(t, err)
+
+	lockout := access.LockoutPolicy{Threshold: 1, Duration: time.Minute}
+
+	return access.NewManager(users, keys, bcrypt.MinCost, lockout, access.PasswordPolicy{})
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	users := newUserStub(t)
+	accessManager := newTestAccessManager(t, users)
+	interceptor := authInterceptor(accessManager)
+
+	token, err := accessManager.Login(context.Background(), testLogin, testPassword)
+	require.NoError(t, err)
+
+	readKey, _, err := accessManager.CreateAPIKey(context.Background(), testUserID, "read", []string{access.ScopeOrdersRead})
+	require.NoError(t, err)
+
+	call := func(method, authValue string) (string, error) {
+		ctx := context.Background()
+		if authValue != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(authMetadata, authValue))
+		}
+
+		var gotUserID string
+		handler := func(ctx context.Context, req any) (any, error) {
+			gotUserID, _ = ctx.Value(userIDKey).(string)
+			return nil, nil
+		}
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return gotUserID, err
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		code   codes.Code
+		userID string
+	}{
+		{name: "public", method: pb.Gophermart_Login_FullMethodName, code: codes.OK},
+		{name: "no token", method: pb.Gophermart_ListOrders_FullMethodName, code: codes.Unauthenticated},
+		{name: "bad token", method: pb.Gophermart_ListOrders_FullMethodName, auth: "Bearer bad", code: codes.Unauthenticated},
+		{name: "token", method: pb.Gophermart_ListOrders_FullMethodName, auth: token, code: codes.OK, userID: testUserID},
+		{name: "key scope", method: pb.Gophermart_ListOrders_FullMethodName, auth: readKey, code: codes.OK, userID: testUserID},
+		{name: "key without scope", method: pb.Gophermart_Withdraw_FullMethodName, auth: readKey, code: codes.PermissionDenied},
+		{name: "unlisted method", method: "/gophermart.Gophermart/Unlisted", auth: token, code: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, err := call(tt.method, tt.auth)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.userID, userID)
+		})
+	}
+}
+
+func TestMethodsAreListed(t *testing.T) {
+	for _, method := range pb.Gophermart_ServiceDesc.Methods {
+		fullMethod := "/" + pb.Gophermart_ServiceDesc.ServiceName + "/" + method.MethodName
+
+		_, public := publicMethods[fullMethod]
+		_, scoped := methodScopes[fullMethod]
+		assert.True(t, public != scoped, fullMethod)
+	}
+}
@@ -0,0 +1,68 @@
+package grpcserver
+
+import (
+	"crypto/tls"
+
+	"github.com/ruskiiamov/gophermart/internal/access"
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/grpcserver/pb"
+	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	authMetadata              = "authorization"
+	tenantMetadata            = "x-tenant-id"
+	authorityMetadata         = ":authority"
+	retryAfterMetadata        = "retry-after"
+	userIDKey          ctxKey = "auth_user_id"
+	scopesKey          ctxKey = "auth_scopes"
+)
+
+type ctxKey string
+
+// publicMethods need no credentials. Every other method must be listed in
+// methodScopes, anything else is denied.
+var publicMethods = map[string]struct{}{
+	pb.Gophermart_Register_FullMethodName: {},
+	pb.Gophermart_Login_FullMethodName:    {},
+}
+
+// methodScopes lists the authenticated methods with the API key scope each one requires.
+var methodScopes = map[string]string{
+	pb.Gophermart_SubmitOrder_FullMethodName: access.ScopeOrdersWrite,
+	pb.Gophermart_ListOrders_FullMethodName:  access.ScopeOrdersRead,
+	pb.Gophermart_GetBalance_FullMethodName:  access.ScopeBalanceRead,
+	pb.Gophermart_Withdraw_FullMethodName:    access.ScopeBalanceWrite,
+}
+
+func NewServer(
+	accessManager *access.Manager,
+	bonusManager *bonus.Manager,
+	taskDispatcher *queue.Dispatcher,
+	limiters ratelimit.Limiters,
+	tenants *tenant.Registry,
+	tlsConfig *tls.Config,
+) *grpc.Server {
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		tenantInterceptor(tenants),
+		authInterceptor(accessManager),
+	)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig.Clone())))
+	}
+
+	s := grpc.NewServer(opts...)
+
+	pb.RegisterGophermartServer(s, &service{
+		accessManager:  accessManager,
+		bonusManager:   bonusManager,
+		taskDispatcher: taskDispatcher,
+		limiters:       limiters,
+	})
+
+	return s
+}
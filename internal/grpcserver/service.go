@@ -0,0 +1,251 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/access"
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/grpcserver/pb"
+	"github.com/ruskiiamov/gophermart/internal/logger"
+	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
+	"github.com/ruskiiamov/gophermart/internal/tasks"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errInternal = status.Error(codes.Internal, "internal error")
+
+type service struct {
+	pb.UnimplementedGophermartServer
+	accessManager  *access.Manager
+	bonusManager   *bonus.Manager
+	taskDispatcher *queue.Dispatcher
+	limiters       ratelimit.Limiters
+}
+
+func userID(ctx context.Context) (string, error) {
+	id, ok := ctx.Value(userIDKey).(string)
+	if !ok || id == "" {
+		return "", status.Error(codes.Unauthenticated, "access token required")
+	}
+
+	return id, nil
+}
+
+func isPolicyError(err error) bool {
+	return errors.Is(err, access.ErrLoginFormat) ||
+		errors.Is(err, access.ErrPasswordTooShort) ||
+		errors.Is(err, access.ErrPasswordTooLong) ||
+		errors.Is(err, access.ErrPasswordTooWeak)
+}
+
+func (s *service) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.AuthResponse, error) {
+	if ok, retryAfter := s.limiters.Register.Allow(peerIP(ctx)); !ok {
+		return nil, tooManyRequests(ctx, retryAfter)
+	}
+
+	if req.Login == "" || req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "login and password required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var referrerID string
+	var err error
+	if req.ReferralCode != "" {
+		referrerID, err = s.bonusManager.GetReferrer(ctx, req.ReferralCode)
+		if errors.Is(err, bonus.ErrReferralCode) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("get referrer error: %s", err))
+			return nil, errInternal
+		}
+	}
+
+	newUserID, err := s.accessManager.Register(ctx, req.Login, req.Password)
+	if errors.Is(err, access.ErrLoginExists) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if isPolicyError(err) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("register error: %s", err))
+		return nil, errInternal
+	}
+
+	if referrerID != "" {
+		err = s.bonusManager.AddReferral(ctx, referrerID, newUserID)
+		if err != nil {
+			logger.Error(fmt.Sprintf("add referral error: %s", err))
+		}
+	}
+
+	accessToken, err := s.accessManager.Login(ctx, req.Login, req.Password)
+	if err != nil {
+		logger.Error(fmt.Sprintf("login error: %s", err))
+		return nil, errInternal
+	}
+
+	return &pb.AuthResponse{Token: accessToken}, nil
+}
+
+func (s *service) Login(ctx context.Context, req *pb.LoginRequest) (*pb.AuthResponse, error) {
+	if ok, retryAfter := s.limiters.Login.Allow(peerIP(ctx)); !ok {
+		return nil, tooManyRequests(ctx, retryAfter)
+	}
+
+	if req.Login == "" || req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "login and password required")
+	}
+
+	if ok, retryAfter := s.limiters.Account.Allow(tenant.FromContext(ctx) + "/" + req.Login); !ok {
+		return nil, tooManyRequests(ctx, retryAfter)
+	}
+
+	loginCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	accessToken, err := s.accessManager.Login(loginCtx, req.Login, req.Password)
+	if errors.Is(err, access.ErrLoginPassword) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	var errLoginLocked *access.ErrLoginLocked
+	if errors.As(err, &errLoginLocked) {
+		return nil, tooManyRequests(ctx, time.Until(errLoginLocked.LockedUntil))
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("login error: %s", err))
+		return nil, errInternal
+	}
+
+	return &pb.AuthResponse{Token: accessToken}, nil
+}
+
+func (s *service) SubmitOrder(ctx context.Context, req *pb.SubmitOrderRequest) (*pb.SubmitOrderResponse, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bonus.ValidateOrderNumber(req.Number)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	addCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	err = s.bonusManager.AddOrder(addCtx, uid, req.Number)
+	if errors.Is(err, bonus.ErrUserHasOrder) {
+		return &pb.SubmitOrderResponse{Accepted: false}, nil
+	}
+	if errors.Is(err, bonus.ErrOrderExists) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if errors.Is(err, bonus.ErrLuhnAlgo) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("add order error: %s", err))
+		return nil, errInternal
+	}
+
+	s.taskDispatcher.Push(tasks.NewAccrualTask(tenant.FromContext(ctx), req.Number))
+
+	return &pb.SubmitOrderResponse{Accepted: true}, nil
+}
+
+func (s *service) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	orders, err := s.bonusManager.GetOrders(ctx, uid)
+	if err != nil {
+		logger.Error(fmt.Sprintf("get orders error: %s", err))
+		return nil, errInternal
+	}
+
+	res := &pb.ListOrdersResponse{Orders: make([]*pb.Order, 0, len(orders))}
+	for _, order := range orders {
+		res.Orders = append(res.Orders, &pb.Order{
+			Number:     order.ID,
+			Status:     order.Status,
+			Accrual:    float64(order.Accrual) / 100,
+			UploadedAt: order.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return res, nil
+}
+
+func (s *service) GetBalance(ctx context.Context, req *pb.GetBalanceRequest) (*pb.Balance, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	current, withdrawn, held, err := s.bonusManager.GetBalance(ctx, uid)
+	if err != nil {
+		logger.Error(fmt.Sprintf("get balance error: %s", err))
+		return nil, errInternal
+	}
+
+	return &pb.Balance{
+		Current:   float64(current) / 100,
+		Withdrawn: float64(withdrawn) / 100,
+		Held:      float64(held) / 100,
+	}, nil
+}
+
+func (s *service) Withdraw(ctx context.Context, req *pb.WithdrawRequest) (*pb.WithdrawResponse, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Order == "" || req.Sum == 0 {
+		return nil, status.Error(codes.InvalidArgument, "order and sum required")
+	}
+
+	err = bonus.ValidateOrderNumber(req.Order)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	err = s.bonusManager.Withdraw(ctx, uid, req.Order, int(math.Round(req.Sum*100)))
+	if errors.Is(err, bonus.ErrWrongSum) || errors.Is(err, bonus.ErrLuhnAlgo) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, bonus.ErrNotEnough) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if errors.Is(err, bonus.ErrOrderExists) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("withdraw error: %s", err))
+		return nil, errInternal
+	}
+
+	return &pb.WithdrawResponse{}, nil
+}
@@ -0,0 +1,86 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/grpcserver/pb"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type balanceStub struct {
+	bonus.BonusProvider
+	current int
+}
+
+func (s *balanceStub) GetOrder(ctx context.Context, orderID string) (*bonus.Order, error) {
+	return nil, bonus.ErrOrderNotFound
+}
+
+func (s *balanceStub) GetBalance(ctx context.Context, userID string) (int, int, int, error) {
+	return s.current, 0, 0, nil
+}
+
+func newTestService(t *testing.T, loginLimit int) *service {
+	limiters := ratelimit.Limiters{
+		Register: ratelimit.NewLimiter(100, time.Minute),
+		Login:    ratelimit.NewLimiter(loginLimit, time.Minute),
+		OIDC:     ratelimit.NewLimiter(100, time.Minute),
+		Account:  ratelimit.NewLimiter(100, time.Minute),
+	}
+
+	return &service{
+		accessManager: newTestAccessManager(t, newUserStub(t)),
+		bonusManager:  bonus.NewManager(&balanceStub{current: 1000}, nil),
+		limiters:      limiters,
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestService(t, 100)
+	ctx := context.Background()
+
+	res, err := s.Login(ctx, &pb.LoginRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.Token)
+
+	_, err = s.Login(ctx, &pb.LoginRequest{Login: testLogin})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.Login(ctx, &pb.LoginRequest{Login: testLogin, Password: "wrong password"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = s.Login(ctx, &pb.LoginRequest{Login: testLogin, Password: testPassword})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "locked out")
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	s := newTestService(t, 1)
+	ctx := context.Background()
+
+	_, err := s.Login(ctx, &pb.LoginRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+
+	_, err = s.Login(ctx, &pb.LoginRequest{Login: testLogin, Password: testPassword})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestWithdraw(t *testing.T) {
+	s := newTestService(t, 100)
+	ctx := context.WithValue(context.Background(), userIDKey, testUserID)
+
+	_, err := s.Withdraw(context.Background(), &pb.WithdrawRequest{Order: "79927398713", Sum: 5})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = s.Withdraw(ctx, &pb.WithdrawRequest{Order: "79927398714", Sum: 5})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.Withdraw(ctx, &pb.WithdrawRequest{Order: "79927398713", Sum: 50})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -6,48 +6,82 @@ import (
 	"time"
 )
 
-type Task interface {
-	Handle() error
-}
-
 type Dispatcher struct {
-	arr         []Task
+	arr         []*Task
 	mu          sync.Mutex
 	cond        *sync.Cond
-	ctx         context.Context
 	lockedUntil time.Time
+	closed      bool
+	lastID      uint64
+	watched     map[<-chan struct{}]struct{}
 }
 
-func NewDispatcher(ctx context.Context) *Dispatcher {
+func NewDispatcher() *Dispatcher {
 	c := &Dispatcher{
-		ctx:         ctx,
 		lockedUntil: time.Now(),
+		watched:     make(map[<-chan struct{}]struct{}),
 	}
 	c.cond = sync.NewCond(&c.mu)
 
 	return c
 }
 
-func (c *Dispatcher) Push(t Task) {
+func (c *Dispatcher) Push(t *Task) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.arr = append(c.arr, t)
+	if c.closed {
+		return
+	}
+
+	c.push(t)
 
 	c.cond.Signal()
 }
 
-func (c *Dispatcher) PopWait() Task {
+func (c *Dispatcher) PushMany(ts []*Task) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	for _, t := range ts {
+		c.push(t)
+	}
+
+	c.cond.Broadcast()
+}
+
+func (c *Dispatcher) push(t *Task) {
+	if t.ID == 0 {
+		c.lastID++
+		t.ID = c.lastID
+	}
+	if t.EnqueuedAt.IsZero() {
+		t.EnqueuedAt = time.Now()
+	}
+
+	c.arr = append(c.arr, t)
+}
+
+func (c *Dispatcher) PopWait(ctx context.Context) *Task {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.watch(ctx)
+
 	for len(c.arr) == 0 || time.Now().Before(c.lockedUntil) {
-		select {
-		case <-c.ctx.Done():
+		if c.closed || ctx.Err() != nil {
 			return nil
-		default:
-			c.cond.Wait()
 		}
+
+		c.cond.Wait()
+	}
+
+	if c.closed || ctx.Err() != nil {
+		return nil
 	}
 
 	t := c.arr[0]
@@ -55,17 +89,54 @@ func (c *Dispatcher) PopWait() Task {
 	return t
 }
 
+// watch wakes the waiters once ctx is done. Workers pass the same context to
+// every PopWait call, so there is one goroutine per context, not per call.
+func (c *Dispatcher) watch(ctx context.Context) {
+	done := ctx.Done()
+	if done == nil {
+		return
+	}
+
+	if _, ok := c.watched[done]; ok {
+		return
+	}
+	c.watched[done] = struct{}{}
+
+	go func() {
+		<-done
+
+		c.mu.Lock()
+		delete(c.watched, done)
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}()
+}
+
 func (c *Dispatcher) SetLockedUntil(lockedUntil time.Time) {
 	if time.Now().After(lockedUntil) {
 		return
 	}
 
+	c.mu.Lock()
 	c.lockedUntil = lockedUntil
+	c.mu.Unlock()
+
 	time.AfterFunc(time.Until(lockedUntil), func() {
 		c.cond.Broadcast()
 	})
 }
 
+func (c *Dispatcher) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.arr)
+}
+
 func (c *Dispatcher) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
 	c.cond.Broadcast()
 }
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher(t *testing.T) {
+	t.Run("fifo order and ids", func(t *testing.T) {
+		d := NewDispatcher()
+		d.PushMany([]*Task{NewTask("a", nil), NewTask("b", nil)})
+		d.Push(NewTask("c", nil))
+
+		ctx := context.Background()
+		for i, taskType := range []string{"a", "b", "c"} {
+			task := d.PopWait(ctx)
+			require.NotNil(t, task)
+			assert.Equal(t, taskType, task.Type)
+			assert.Equal(t, uint64(i+1), task.ID)
+			assert.False(t, task.EnqueuedAt.IsZero())
+		}
+		assert.Zero(t, d.Len())
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		d := NewDispatcher()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		popped := make(chan *Task)
+		go func() { popped <- d.PopWait(ctx) }()
+
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+
+		select {
+		case task := <-popped:
+			assert.Nil(t, task)
+		case <-time.After(time.Second):
+			t.Fatal("PopWait did not return after cancellation")
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		d := NewDispatcher()
+
+		popped := make(chan *Task)
+		go func() { popped <- d.PopWait(context.Background()) }()
+
+		time.Sleep(10 * time.Millisecond)
+		d.Close()
+		d.Push(NewTask("a", nil))
+
+		select {
+		case task := <-popped:
+			assert.Nil(t, task)
+		case <-time.After(time.Second):
+			t.Fatal("PopWait did not return after close")
+		}
+		assert.Zero(t, d.Len())
+	})
+
+	t.Run("locked until", func(t *testing.T) {
+		d := NewDispatcher()
+		d.SetLockedUntil(time.Now().Add(30 * time.Millisecond))
+		d.Push(NewTask("a", nil))
+
+		start := time.Now()
+		task := d.PopWait(context.Background())
+		require.NotNil(t, task)
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+}
+
+func TestEvery(t *testing.T) {
+	d := NewDispatcher()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		Every(ctx, d, 10*time.Millisecond, func() []*Task {
+			return []*Task{NewTask("tiers", nil)}
+		})
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		popCtx, popCancel := context.WithTimeout(context.Background(), time.Second)
+		task := d.PopWait(popCtx)
+		popCancel()
+		require.NotNil(t, task)
+		assert.Equal(t, "tiers", task.Type)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Every did not stop after cancellation")
+	}
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+)
+
+type ErrUnknownType struct {
+	Type string
+}
+
+func (e *ErrUnknownType) Error() string {
+	return fmt.Sprintf("unknown task type %q", e.Type)
+}
+
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler)}
+}
+
+func (r *Registry) Register(taskType string, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handlers[taskType]; ok {
+		panic(fmt.Sprintf("task type %q already registered", taskType))
+	}
+
+	r.handlers[taskType] = h
+}
+
+func (r *Registry) Handler(taskType string) (Handler, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	h, ok := r.handlers[taskType]
+	if !ok {
+		return nil, &ErrUnknownType{Type: taskType}
+	}
+
+	return h, nil
+}
@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	noop := HandlerFunc(func(ctx context.Context, t *Task) error { return nil })
+
+	registry.Register("accrual", noop)
+
+	t.Run("registered type", func(t *testing.T) {
+		h, err := registry.Handler("accrual")
+		require.NoError(t, err)
+		assert.NotNil(t, h)
+	})
+
+	t.Run("duplicate type", func(t *testing.T) {
+		assert.Panics(t, func() { registry.Register("accrual", noop) })
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := registry.Handler("tiers")
+
+		var errUnknownType *ErrUnknownType
+		require.ErrorAs(t, err, &errUnknownType)
+		assert.Equal(t, "tiers", errUnknownType.Type)
+	})
+}
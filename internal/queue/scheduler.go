@@ -0,0 +1,24 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Every pushes the tasks made by newTasks right away and then on each
+// interval until ctx is done.
+func Every(ctx context.Context, d *Dispatcher, interval time.Duration, newTasks func() []*Task) {
+	d.PushMany(newTasks())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.PushMany(newTasks())
+		}
+	}
+}
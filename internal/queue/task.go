@@ -0,0 +1,31 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+type Task struct {
+	ID         uint64
+	Type       string
+	Attempt    int
+	EnqueuedAt time.Time
+	Payload    any
+}
+
+func NewTask(taskType string, payload any) *Task {
+	return &Task{
+		Type:    taskType,
+		Payload: payload,
+	}
+}
+
+type Handler interface {
+	Handle(ctx context.Context, t *Task) error
+}
+
+type HandlerFunc func(ctx context.Context, t *Task) error
+
+func (f HandlerFunc) Handle(ctx context.Context, t *Task) error {
+	return f(ctx, t)
+}
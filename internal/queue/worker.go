@@ -9,8 +9,11 @@ import (
 	"github.com/ruskiiamov/gophermart/internal/logger"
 )
 
+// ErrRetryAfter puts the task back in the queue. Poll marks a task that waits
+// for something rather than failed, its attempt is not counted.
 type ErrRetryAfter struct {
 	Duration time.Duration
+	Poll     bool
 }
 
 func (e *ErrRetryAfter) Error() string {
@@ -19,26 +22,37 @@ func (e *ErrRetryAfter) Error() string {
 
 type Worker struct {
 	taskDispatcher *Dispatcher
+	registry       *Registry
 }
 
-func NewWorker(taskDispatcher *Dispatcher) *Worker {
-	return &Worker{taskDispatcher: taskDispatcher}
+func NewWorker(taskDispatcher *Dispatcher, registry *Registry) *Worker {
+	return &Worker{
+		taskDispatcher: taskDispatcher,
+		registry:       registry,
+	}
 }
 
 func (w *Worker) Loop(ctx context.Context) {
 	for {
-		t := w.taskDispatcher.PopWait()
-
-		select {
-		case <-ctx.Done():
+		t := w.taskDispatcher.PopWait(ctx)
+		if t == nil {
 			return
-		default:
 		}
 
-		err := t.Handle()
+		h, err := w.registry.Handler(t.Type)
+		if err != nil {
+			logger.Error(fmt.Sprintf("task %d dropped: %s", t.ID, err))
+			continue
+		}
+
+		t.Attempt++
+		err = h.Handle(ctx, t)
 
 		var errRetryAfter *ErrRetryAfter
 		if errors.As(err, &errRetryAfter) {
+			if errRetryAfter.Poll {
+				t.Attempt--
+			}
 			if errRetryAfter.Duration > 0 {
 				w.taskDispatcher.SetLockedUntil(time.Now().Add(errRetryAfter.Duration))
 			}
@@ -47,7 +61,7 @@ func (w *Worker) Loop(ctx context.Context) {
 		}
 
 		if err != nil {
-			logger.Error(fmt.Sprintf("task failed: %s", err))
+			logger.Error(fmt.Sprintf("task %d (%s, attempt %d) failed: %s", t.ID, t.Type, t.Attempt, err))
 		}
 	}
 }
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerLoop(t *testing.T) {
+	d := NewDispatcher()
+	registry := NewRegistry()
+
+	handled := make(chan Task, 10)
+	registry.Register("ok", HandlerFunc(func(ctx context.Context, t *Task) error {
+		handled <- *t
+		return nil
+	}))
+	registry.Register("retry", HandlerFunc(func(ctx context.Context, t *Task) error {
+		handled <- *t
+		if t.Attempt < 2 {
+			return &ErrRetryAfter{}
+		}
+		return nil
+	}))
+	polled := false
+	registry.Register("poll", HandlerFunc(func(ctx context.Context, t *Task) error {
+		handled <- *t
+		if !polled {
+			polled = true
+			return &ErrRetryAfter{Poll: true}
+		}
+		return nil
+	}))
+	registry.Register("fail", HandlerFunc(func(ctx context.Context, t *Task) error {
+		handled <- *t
+		return errors.New("handler failed")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewWorker(d, registry).Loop(ctx)
+		close(done)
+	}()
+
+	d.PushMany([]*Task{
+		NewTask("unknown", nil),
+		NewTask("fail", nil),
+		NewTask("retry", nil),
+		NewTask("poll", nil),
+		NewTask("ok", nil),
+	})
+
+	var got []string
+	var attempts []int
+	for i := 0; i < 6; i++ {
+		select {
+		case task := <-handled:
+			got = append(got, task.Type)
+			attempts = append(attempts, task.Attempt)
+		case <-time.After(time.Second):
+			t.Fatalf("handled %v, want 6 runs", got)
+		}
+	}
+
+	assert.Equal(t, []string{"fail", "retry", "poll", "ok", "retry", "poll"}, got,
+		"unknown types are dropped, retries go to the back")
+	assert.Equal(t, []int{1, 1, 1, 1, 2, 1}, attempts, "polling is not counted")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop after cancellation")
+	}
+}
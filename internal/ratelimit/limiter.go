@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	start time.Time
+	hits  int
+}
+
+type Limiter struct {
+	limit     int
+	period    time.Duration
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+func NewLimiter(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:     limit,
+		period:    period,
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	if l == nil || l.limit <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > l.period {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.period {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.period {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	if w.hits >= l.limit {
+		return false, w.start.Add(l.period).Sub(now)
+	}
+
+	w.hits++
+
+	return true, 0
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	limiter := NewLimiter(2, time.Minute)
+
+	t.Run("under limit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			ok, retryAfter := limiter.Allow("127.0.0.1")
+			assert.True(t, ok)
+			assert.Zero(t, retryAfter)
+		}
+	})
+
+	t.Run("over limit", func(t *testing.T) {
+		ok, retryAfter := limiter.Allow("127.0.0.1")
+		assert.False(t, ok)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.LessOrEqual(t, retryAfter, time.Minute)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		ok, _ := limiter.Allow("10.0.0.1")
+		assert.True(t, ok)
+	})
+
+	t.Run("window reset", func(t *testing.T) {
+		limiter := NewLimiter(1, 10*time.Millisecond)
+
+		ok, _ := limiter.Allow("test_login")
+		assert.True(t, ok)
+		ok, _ = limiter.Allow("test_login")
+		assert.False(t, ok)
+
+		time.Sleep(15 * time.Millisecond)
+
+		ok, _ = limiter.Allow("test_login")
+		assert.True(t, ok)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		limiter := NewLimiter(0, time.Minute)
+		for i := 0; i < 10; i++ {
+			ok, _ := limiter.Allow("127.0.0.1")
+			assert.True(t, ok)
+		}
+	})
+}
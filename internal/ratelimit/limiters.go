@@ -0,0 +1,10 @@
+package ratelimit
+
+// Limiters gives each public auth endpoint its own budget, so a wave of
+// signups can't lock clients out of logging in.
+type Limiters struct {
+	Register *Limiter // per client IP
+	Login    *Limiter // per client IP
+	OIDC     *Limiter // per client IP
+	Account  *Limiter // per tenant and login
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// readBody reads the request body, which bodyLimitMiddleware has already
+// capped, and reports an oversized body as errBodyTooLarge.
+func readBody(r *http.Request) ([]byte, error) {
+	content, err := io.ReadAll(r.Body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, fmt.Errorf("%w: limit is %d bytes", errBodyTooLarge, maxBytesErr.Limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errReadBody, err)
+	}
+
+	return content, nil
+}
+
+// decodeJSON reads a single JSON value into v and rejects unknown fields and
+// trailing data.
+func decodeJSON(r *http.Request, v interface{}) error {
+	content, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidJSON, err)
+	}
+
+	return checkJSONEnd(decoder)
+}
+
+// checkJSONEnd rejects anything but whitespace after the decoded value,
+// including a stray closing bracket that decoder.More doesn't see.
+func checkJSONEnd(decoder *json.Decoder) error {
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after json value", errInvalidJSON)
+	}
+
+	return nil
+}
+
+func writeBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, err)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+	}{
+		{"valid", `{"login":"user","password":"secret"}`, nil},
+		{"unknown field", `{"login":"user","password":"secret","admin":true}`, errInvalidJSON},
+		{"trailing data", `{"login":"user","password":"secret"}{}`, errInvalidJSON},
+		{"trailing brace", `{"login":"user","password":"secret"}}`, errInvalidJSON},
+		{"trailing bracket", `{"login":"user","password":"secret"}]`, errInvalidJSON},
+		{"trailing whitespace", "{\"login\":\"user\",\"password\":\"secret\"}\n", nil},
+		{"malformed", `{"login":`, errInvalidJSON},
+		{"too large", `{"login":"` + strings.Repeat("a", 128) + `"}`, errBodyTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Body = http.MaxBytesReader(w, r.Body, 64)
+
+			var req request
+			err := decodeJSON(r, &req)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	handler := newTestServer(t).Handler
+
+	r := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(`{"login":"`+strings.Repeat("a", 2048)+`"}`))
+	r.Header.Set(contTypeHeader, appJSON)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	var p problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "body_too_large", p.Code)
+}
+
+func TestReadBatchNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		numbers []string
+		err     error
+	}{
+		{"valid", `["79927398713", 12345678903]`, []string{"79927398713", "12345678903"}, nil},
+		{"trailing bracket", `["79927398713"]]`, nil, errInvalidJSON},
+		{"trailing data", `["79927398713"][]`, nil, errInvalidJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set(contTypeHeader, appJSON)
+
+			numbers, err := readBatchNumbers(r)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.numbers, numbers)
+		})
+	}
+}
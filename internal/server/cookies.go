@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	sessionCookie = "session"
+	csrfCookie    = "csrf_token"
+	csrfHeader    = "X-CSRF-Token"
+	cookiePath    = "/api"
+)
+
+// CookieConfig enables sessions kept in an HttpOnly cookie for browsers.
+// Requests authenticated by the cookie must repeat the CSRF token, which is
+// handed out in the X-CSRF-Token header, unless they are safe.
+type CookieConfig struct {
+	Enabled  bool
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown same site mode: %s", value)
+	}
+}
+
+func writeToken(w http.ResponseWriter, cookies CookieConfig, accessToken string) error {
+	w.Header().Add(authHeader, accessToken)
+
+	if !cookies.Enabled {
+		return nil
+	}
+
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, cookies.cookie(sessionCookie, accessToken, true))
+	http.SetCookie(w, cookies.cookie(csrfCookie, csrfToken, false))
+	w.Header().Set(csrfHeader, csrfToken)
+
+	return nil
+}
+
+func clearSession(w http.ResponseWriter, cookies CookieConfig) {
+	for _, name := range []string{sessionCookie, csrfCookie} {
+		c := cookies.cookie(name, "", name == sessionCookie)
+		c.MaxAge = -1
+		http.SetCookie(w, c)
+	}
+}
+
+// sessionToken returns the access token from the session cookie, or an empty
+// string when there is none.
+func sessionToken(r *http.Request) (string, error) {
+	session, err := r.Cookie(sessionCookie)
+	if err != nil || session.Value == "" {
+		return "", nil
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return session.Value, nil
+	}
+
+	csrf, err := r.Cookie(csrfCookie)
+	if err != nil || csrf.Value == "" {
+		return "", errCSRF
+	}
+
+	if subtle.ConstantTimeCompare([]byte(csrf.Value), []byte(r.Header.Get(csrfHeader))) != 1 {
+		return "", errCSRF
+	}
+
+	return session.Value, nil
+}
+
+func (c CookieConfig) cookie(name, value string, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cookiePath,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("csrf token generation error: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToken(t *testing.T) {
+	t.Run("header only", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		require.NoError(t, writeToken(w, CookieConfig{}, "token"))
+
+		assert.Equal(t, "token", w.Header().Get(authHeader))
+		assert.Empty(t, w.Result().Cookies())
+		assert.Empty(t, w.Header().Get(csrfHeader))
+	})
+
+	t.Run("cookies", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		cookies := CookieConfig{Enabled: true, Secure: true, SameSite: http.SameSiteStrictMode}
+		require.NoError(t, writeToken(w, cookies, "token"))
+
+		csrfToken := w.Header().Get(csrfHeader)
+		assert.NotEmpty(t, csrfToken)
+
+		byName := make(map[string]*http.Cookie)
+		for _, c := range w.Result().Cookies() {
+			byName[c.Name] = c
+		}
+
+		require.Contains(t, byName, sessionCookie)
+		assert.Equal(t, "token", byName[sessionCookie].Value)
+		assert.True(t, byName[sessionCookie].HttpOnly)
+		assert.True(t, byName[sessionCookie].Secure)
+		assert.Equal(t, http.SameSiteStrictMode, byName[sessionCookie].SameSite)
+
+		require.Contains(t, byName, csrfCookie)
+		assert.Equal(t, csrfToken, byName[csrfCookie].Value)
+		assert.False(t, byName[csrfCookie].HttpOnly)
+	})
+}
+
+func TestSessionToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header string
+		token  string
+		err    error
+	}{
+		{"safe method", http.MethodGet, "", "token", nil},
+		{"unsafe method with csrf", http.MethodPost, "csrf", "token", nil},
+		{"unsafe method without csrf", http.MethodPost, "", "", errCSRF},
+		{"unsafe method with wrong csrf", http.MethodDelete, "other", "", errCSRF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/user/orders", nil)
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: "token"})
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "csrf"})
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, tt.header)
+			}
+
+			token, err := sessionToken(r)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.token, token)
+		})
+	}
+
+	t.Run("no session", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+
+		token, err := sessionToken(r)
+		assert.NoError(t, err)
+		assert.Empty(t, token)
+	})
+}
+
+func TestCookieSessionCSRF(t *testing.T) {
+	handler := newTestServer(t).Handler
+
+	r := httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader("12345678903"))
+	r.Header.Set(contTypeHeader, textPlain)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: "token"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var p problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "csrf_failed", p.Code)
+}
+
+func TestLogout(t *testing.T) {
+	handler := newTestServer(t).Handler
+
+	r := httptest.NewRequest(http.MethodPost, "/api/user/logout", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	for _, c := range w.Result().Cookies() {
+		assert.Equal(t, -1, c.MaxAge)
+	}
+	assert.Len(t, w.Result().Cookies(), 2)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+)
+
+const (
+	originHeader           = "Origin"
+	varyHeader             = "Vary"
+	allowOriginHeader      = "Access-Control-Allow-Origin"
+	allowCredentialsHeader = "Access-Control-Allow-Credentials"
+	allowMethodsHeader     = "Access-Control-Allow-Methods"
+	allowHeadersHeader     = "Access-Control-Allow-Headers"
+	exposeHeadersHeader    = "Access-Control-Expose-Headers"
+	maxAgeHeader           = "Access-Control-Max-Age"
+	requestMethodHeader    = "Access-Control-Request-Method"
+	anyOrigin              = "*"
+)
+
+type CORSConfig struct {
+	AllowedOrigins []string
+	MaxAge         time.Duration
+}
+
+// corsMiddleware lets browsers on the allowed origins call the API. Listed
+// origins may send cookies, the "*" wildcard only allows credential-less calls.
+func corsMiddleware(cfg CORSConfig) func(http.Handler) http.Handler {
+	origins := make(map[string]struct{}, len(cfg.AllowedOrigins))
+	for _, o := range cfg.AllowedOrigins {
+		origins[strings.TrimSuffix(o, "/")] = struct{}{}
+	}
+	_, wildcard := origins[anyOrigin]
+
+	allowMethods := strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}, ", ")
+	allowHeaders := strings.Join([]string{authHeader, contTypeHeader, csrfHeader, ifNoneMatchHeader, tenant.Header}, ", ")
+	exposeHeaders := strings.Join([]string{authHeader, retryAfterHeader, csrfHeader, etagHeader}, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		if len(origins) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get(originHeader)
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add(varyHeader, originHeader)
+
+			_, listed := origins[origin]
+			switch {
+			case listed:
+				h.Set(allowOriginHeader, origin)
+				h.Set(allowCredentialsHeader, "true")
+			case wildcard:
+				h.Set(allowOriginHeader, anyOrigin)
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method != http.MethodOptions || r.Header.Get(requestMethodHeader) == "" {
+				h.Set(exposeHeadersHeader, exposeHeaders)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set(allowMethodsHeader, allowMethods)
+			h.Set(allowHeadersHeader, allowHeaders)
+			h.Set(maxAgeHeader, maxAge)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		origin      string
+		preflight   bool
+		status      int
+		allowOrigin string
+		credentials string
+	}{
+		{"disabled", nil, http.MethodGet, "https://shop.example.com", false, http.StatusOK, "", ""},
+		{"no origin", []string{"https://shop.example.com"}, http.MethodGet, "", false, http.StatusOK, "", ""},
+		{"listed origin", []string{"https://shop.example.com/"}, http.MethodGet, "https://shop.example.com", false, http.StatusOK, "https://shop.example.com", "true"},
+		{"unknown origin", []string{"https://shop.example.com"}, http.MethodGet, "https://evil.example.com", false, http.StatusOK, "", ""},
+		{"wildcard", []string{"*"}, http.MethodGet, "https://any.example.com", false, http.StatusOK, "*", ""},
+		{"preflight", []string{"https://shop.example.com"}, http.MethodOptions, "https://shop.example.com", true, http.StatusNoContent, "https://shop.example.com", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := corsMiddleware(CORSConfig{AllowedOrigins: tt.origins, MaxAge: time.Minute})(next)
+
+			r := httptest.NewRequest(tt.method, "/api/user/orders", nil)
+			if tt.origin != "" {
+				r.Header.Set(originHeader, tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set(requestMethodHeader, http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.allowOrigin, w.Header().Get(allowOriginHeader))
+			assert.Equal(t, tt.credentials, w.Header().Get(allowCredentialsHeader))
+
+			if tt.preflight {
+				assert.Contains(t, w.Header().Get(allowHeadersHeader), csrfHeader)
+				assert.Equal(t, "60", w.Header().Get(maxAgeHeader))
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+)
+
+const (
+	etagHeader         = "ETag"
+	ifNoneMatchHeader  = "If-None-Match"
+	cacheControlHeader = "Cache-Control"
+	revalidate         = "private, no-cache"
+)
+
+// etagMiddleware makes a read endpoint conditional on the user's data
+// version: a matching If-None-Match gets 304 without running the handler and,
+// with a cache, an unchanged version is answered from memory.
+func etagMiddleware(bonusManager *bonus.Manager, cache *responseCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(userIDKey).(string)
+			if !ok || userID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+			version, err := bonusManager.GetDataVersion(ctx, userID)
+			cancel()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			etag := makeETag(userID, version)
+			w.Header().Add(varyHeader, authHeader)
+			w.Header().Add(varyHeader, "Cookie")
+
+			if etagMatches(r.Header.Get(ifNoneMatchHeader), etag) {
+				setValidators(w, etag)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			key := userID + " " + r.URL.RequestURI()
+			if res, ok := cache.get(key, version); ok {
+				setValidators(w, etag)
+				if res.contentType != "" {
+					w.Header().Set(contTypeHeader, res.contentType)
+				}
+				w.WriteHeader(res.status)
+				w.Write(res.body)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, etag: etag}
+			next.ServeHTTP(ew, r)
+
+			if ew.status == http.StatusOK || ew.status == http.StatusNoContent {
+				cache.set(key, &cachedResponse{
+					version:     version,
+					status:      ew.status,
+					contentType: w.Header().Get(contTypeHeader),
+					body:        ew.body.Bytes(),
+				})
+			}
+		})
+	}
+}
+
+func makeETag(userID string, version int64) string {
+	sum := sha256.Sum256([]byte(userID))
+	return fmt.Sprintf(`W/"%x-%d"`, sum[:8], version)
+}
+
+// etagMatches uses the weak comparison required for If-None-Match.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func setValidators(w http.ResponseWriter, etag string) {
+	w.Header().Set(etagHeader, etag)
+	w.Header().Set(cacheControlHeader, revalidate)
+}
+
+// etagWriter only attaches the validators to successful responses and keeps
+// a copy of the body for the cache.
+type etagWriter struct {
+	http.ResponseWriter
+	etag   string
+	status int
+	body   bytes.Buffer
+}
+
+func (w *etagWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+
+	w.status = status
+	if status == http.StatusOK || status == http.StatusNoContent {
+		setValidators(w.ResponseWriter, w.etag)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *etagWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+type cachedResponse struct {
+	version     int64
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// responseCache keeps rendered read responses for a short time. Entries are
+// tied to the data version they were rendered at, so any write makes them
+// stale immediately. A nil cache is disabled.
+type responseCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]*cachedResponse
+	lastSweep time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &responseCache{
+		ttl:       ttl,
+		entries:   make(map[string]*cachedResponse),
+		lastSweep: time.Now(),
+	}
+}
+
+func (c *responseCache) get(key string, version int64) (*cachedResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if res.version != version || time.Now().After(res.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return res, true
+}
+
+func (c *responseCache) set(key string, res *cachedResponse) {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	res.expiresAt = now.Add(c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[key] = res
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionProvider struct {
+	bonus.BonusProvider
+	version int64
+}
+
+func (p *versionProvider) GetDataVersion(ctx context.Context, userID string) (int64, error) {
+	return p.version, nil
+}
+
+func TestETagMiddleware(t *testing.T) {
+	provider := &versionProvider{version: 1}
+	bonusManager := bonus.NewManager(provider, nil)
+
+	calls := 0
+	status := http.StatusOK
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if status != http.StatusOK {
+			writeError(w, status, errNotFound)
+			return
+		}
+		w.Header().Set(contTypeHeader, appJSON)
+		w.Write([]byte(`{"current":1}`))
+	})
+
+	request := func(handler http.Handler, userID, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+		r = r.WithContext(context.WithValue(r.Context(), userIDKey, userID))
+		if ifNoneMatch != "" {
+			r.Header.Set(ifNoneMatchHeader, ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("without cache", func(t *testing.T) {
+		handler := etagMiddleware(bonusManager, nil)(next)
+		calls = 0
+
+		w := request(handler, "user-a", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		etag := w.Header().Get(etagHeader)
+		assert.NotEmpty(t, etag)
+		assert.Equal(t, revalidate, w.Header().Get(cacheControlHeader))
+
+		w = request(handler, "user-a", `"other", `+etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get(etagHeader))
+		assert.Equal(t, 1, calls)
+
+		w = request(handler, "user-b", etag)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		provider.version = 2
+		w = request(handler, "user-a", etag)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get(etagHeader))
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("with cache", func(t *testing.T) {
+		handler := etagMiddleware(bonusManager, newResponseCache(time.Minute))(next)
+		calls = 0
+
+		first := request(handler, "user-a", "")
+		second := request(handler, "user-a", "")
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, appJSON, second.Header().Get(contTypeHeader))
+		assert.Equal(t, first.Header().Get(etagHeader), second.Header().Get(etagHeader))
+
+		provider.version = 3
+		request(handler, "user-a", "")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		handler := etagMiddleware(bonusManager, newResponseCache(time.Minute))(next)
+		calls = 0
+		status = http.StatusNotFound
+
+		w := request(handler, "user-a", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, w.Header().Get(etagHeader))
+
+		request(handler, "user-a", "")
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	assert.Nil(t, newResponseCache(0))
+
+	cache := newResponseCache(time.Millisecond)
+	cache.set("key", &cachedResponse{version: 1, status: http.StatusOK})
+
+	_, ok := cache.get("key", 1)
+	assert.True(t, ok)
+
+	time.Sleep(5 * time.Millisecond)
+	_, ok = cache.get("key", 1)
+	assert.False(t, ok)
+}
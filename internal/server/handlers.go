@@ -1,98 +1,122 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/ruskiiamov/gophermart/internal/access"
 	"github.com/ruskiiamov/gophermart/internal/bonus"
 	"github.com/ruskiiamov/gophermart/internal/logger"
 	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
+	"github.com/ruskiiamov/gophermart/internal/statement"
 	"github.com/ruskiiamov/gophermart/internal/tasks"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
 )
 
 type request struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty"`
 }
 
-func registerHnadler(accessManager *access.Manager) http.HandlerFunc {
+func registerHnadler(accessManager *access.Manager, bonusManager *bonus.Manager, cookies CookieConfig) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req request
 
-		content, err := io.ReadAll(r.Body)
+		err := decodeJSON(r, &req)
 		if err != nil {
-			logger.Error(fmt.Sprintf("body read error: %s", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
-		err = json.Unmarshal(content, &req)
-		if err != nil {
-			logger.Error(fmt.Sprintf("json unmarshall error: %s", err))
-			w.WriteHeader(http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 
 		if req.Login == "" || req.Password == "" {
-			logger.Error("wrong json structure")
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, errMissingField)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
-		err = accessManager.Register(ctx, req.Login, req.Password)
+		var referrerID string
+		if req.ReferralCode != "" {
+			referrerID, err = bonusManager.GetReferrer(ctx, req.ReferralCode)
+			if errors.Is(err, bonus.ErrReferralCode) {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("get referrer error: %w", err))
+				return
+			}
+		}
+
+		userID, err := accessManager.Register(ctx, req.Login, req.Password)
 		if errors.Is(err, access.ErrLoginExists) {
-			w.WriteHeader(http.StatusConflict)
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if isPolicyError(err) {
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 		if err != nil {
-			logger.Error(fmt.Sprintf("register error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("register error: %w", err))
 			return
 		}
 
+		if referrerID != "" {
+			err = bonusManager.AddReferral(ctx, referrerID, userID)
+			if err != nil {
+				logger.Error(fmt.Sprintf("add referral error: %s", err))
+			}
+		}
+
 		accessToken, err := accessManager.Login(ctx, req.Login, req.Password)
 		if err != nil {
-			logger.Error(fmt.Sprintf("login error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("login error: %w", err))
+			return
+		}
+
+		err = writeToken(w, cookies, accessToken)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		w.Header().Add(authHeader, accessToken)
 		w.WriteHeader(http.StatusOK)
 	})
 }
 
-func loginHandler(accessManager *access.Manager) http.HandlerFunc {
+func loginHandler(accessManager *access.Manager, loginLimiter *ratelimit.Limiter, cookies CookieConfig) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req request
 
-		content, err := io.ReadAll(r.Body)
+		err := decodeJSON(r, &req)
 		if err != nil {
-			logger.Error(fmt.Sprintf("body read error: %s", err))
-			w.WriteHeader(http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 
-		err = json.Unmarshal(content, &req)
-		if err != nil {
-			logger.Error(fmt.Sprintf("json unmarshall error: %s", err))
-			w.WriteHeader(http.StatusBadRequest)
+		if req.Login == "" || req.Password == "" {
+			writeError(w, http.StatusBadRequest, errMissingField)
 			return
 		}
 
-		if req.Login == "" || req.Password == "" {
-			logger.Error("wrong json structure")
-			w.WriteHeader(http.StatusBadRequest)
+		ok, retryAfter := loginLimiter.Allow(tenant.FromContext(r.Context()) + "/" + req.Login)
+		if !ok {
+			writeTooManyRequests(w, retryAfter, errRateLimited)
 			return
 		}
 
@@ -101,154 +125,324 @@ func loginHandler(accessManager *access.Manager) http.HandlerFunc {
 
 		accessToken, err := accessManager.Login(ctx, req.Login, req.Password)
 		if errors.Is(err, access.ErrLoginPassword) {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		var errLoginLocked *access.ErrLoginLocked
+		if errors.As(err, &errLoginLocked) {
+			writeTooManyRequests(w, time.Until(errLoginLocked.LockedUntil), err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("login error: %w", err))
 			return
 		}
+
+		err = writeToken(w, cookies, accessToken)
 		if err != nil {
-			logger.Error(fmt.Sprintf("login error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		w.Header().Add(authHeader, accessToken)
 		w.WriteHeader(http.StatusOK)
 	})
 }
 
-func postOrderHandler(bonusManager *bonus.Manager, taskDispatcher *queue.Dispatcher) http.HandlerFunc {
+func oidcLoginHandler(accessManager *access.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		authURL, state, err := accessManager.StartOIDC(ctx)
+		if errors.Is(err, access.ErrOIDCDisabled) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("start oidc error: %w", err))
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/api/user/oidc",
+			MaxAge:   int((10 * time.Minute).Seconds()),
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+func oidcCallbackHandler(accessManager *access.Manager, cookies CookieConfig) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var expectedState string
+		if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+			expectedState = cookie.Value
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Path:     "/api/user/oidc",
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+
+		query := r.URL.Query()
+		if query.Get("error") != "" {
+			writeError(w, http.StatusUnauthorized, errOIDCFailed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		accessToken, err := accessManager.FinishOIDC(ctx, query.Get("code"), query.Get("state"), expectedState)
+		if errors.Is(err, access.ErrOIDCDisabled) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if errors.Is(err, access.ErrOIDCState) || errors.Is(err, access.ErrOIDCToken) {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if errors.Is(err, access.ErrOIDCNotAvailable) {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("finish oidc error: %w", err))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("finish oidc error: %w", err))
+			return
+		}
+
+		err = writeToken(w, cookies, accessToken)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func logoutHandler(cookies CookieConfig) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clearSession(w, cookies)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func jwksHandler(accessManager *access.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := json.Marshal(accessManager.JWKS(r.Context()))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+type changePasswordReq struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func changePasswordHandler(accessManager *access.Manager, loginLimiter *ratelimit.Limiter, cookies CookieConfig) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value(userIDKey).(string)
 		if !ok || userID == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
 			return
 		}
 
-		orderID, err := io.ReadAll(r.Body)
+		var req changePasswordReq
+
+		err := decodeJSON(r, &req)
 		if err != nil {
-			logger.Error(fmt.Sprintf("body read error: %s", err))
-			w.WriteHeader(http.StatusBadRequest)
+			writeBodyError(w, err)
+			return
+		}
+
+		if req.OldPassword == "" || req.NewPassword == "" {
+			writeError(w, http.StatusBadRequest, errMissingField)
 			return
 		}
 
-		intOrderID, err := strconv.Atoi(string(orderID))
-		if err != nil || intOrderID <= 0 {
-			w.WriteHeader(http.StatusBadRequest)
+		ok, retryAfter := loginLimiter.Allow(tenant.FromContext(r.Context()) + "/" + userID)
+		if !ok {
+			writeTooManyRequests(w, retryAfter, errRateLimited)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
-		err = bonusManager.AddOrder(ctx, userID, intOrderID)
-		if errors.Is(err, bonus.ErrUserHasOrder) {
-			w.WriteHeader(http.StatusOK)
+		accessToken, err := accessManager.ChangePassword(ctx, userID, req.OldPassword, req.NewPassword)
+		if errors.Is(err, access.ErrLoginPassword) {
+			writeError(w, http.StatusForbidden, err)
 			return
 		}
-		if errors.Is(err, bonus.ErrOrderExists) {
-			w.WriteHeader(http.StatusConflict)
+		var errLoginLocked *access.ErrLoginLocked
+		if errors.As(err, &errLoginLocked) {
+			writeTooManyRequests(w, time.Until(errLoginLocked.LockedUntil), err)
 			return
 		}
-		if errors.Is(err, bonus.ErrLuhnAlgo) {
-			w.WriteHeader(http.StatusUnprocessableEntity)
+		if isPolicyError(err) {
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 		if err != nil {
-			logger.Error(fmt.Sprintf("add order error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("change password error: %w", err))
 			return
 		}
 
-		taskDispatcher.Push(tasks.NewAccrualTask(bonusManager, intOrderID))
+		err = writeToken(w, cookies, accessToken)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
 
-		w.WriteHeader(http.StatusAccepted)
+		w.WriteHeader(http.StatusOK)
 	})
 }
 
-type orderRes struct {
-	Number     string  `json:"number"`
-	Status     string  `json:"status"`
-	Accrual    float64 `json:"accrual,omitempty"`
-	UploadedAt string  `json:"uploaded_at"`
-}
-
-func getOrdersHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+func deleteUserHandler(accessManager *access.Manager) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value(userIDKey).(string)
 		if !ok || userID == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
-		orders, err := bonusManager.GetOrders(ctx, userID)
+		err := accessManager.DeleteUser(ctx, userID)
+		if errors.Is(err, access.ErrUserNotFound) {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
 		if err != nil {
-			logger.Error(fmt.Sprintf("get orders error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("delete user error: %w", err))
 			return
 		}
 
-		if len(orders) == 0 {
-			w.WriteHeader(http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type apiKeyReq struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type apiKeyRes struct {
+	ID         string   `json:"id"`
+	Key        string   `json:"key,omitempty"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+}
+
+func newAPIKeyRes(key *access.APIKey) apiKeyRes {
+	res := apiKeyRes{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+
+	if !key.LastUsedAt.IsZero() {
+		res.LastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+
+	return res
+}
+
+func createAPIKeyHandler(accessManager *access.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
 			return
 		}
 
-		resItems := make([]orderRes, 0, len(orders))
-		for _, order := range orders {
-			resItems = append(resItems, orderRes{
-				Number:     strconv.Itoa(order.ID),
-				Status:     order.Status,
-				Accrual:    float64(order.Accrual) / 100,
-				UploadedAt: order.CreatedAt.Format(time.RFC3339),
-			})
+		var req apiKeyReq
+
+		err := decodeJSON(r, &req)
+		if err != nil {
+			writeBodyError(w, err)
+			return
 		}
 
-		content, err := json.Marshal(resItems)
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		plain, key, err := accessManager.CreateAPIKey(ctx, userID, req.Name, req.Scopes)
+		if errors.Is(err, access.ErrAPIKeyName) || errors.Is(err, access.ErrAPIKeyScopes) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("create api key error: %w", err))
+			return
+		}
+
+		res := newAPIKeyRes(key)
+		res.Key = plain
+
+		content, err := json.Marshal(res)
 		if err != nil {
-			logger.Error(fmt.Sprintf("json marshall error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
 			return
 		}
 
 		w.Header().Add(contTypeHeader, appJSON)
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(http.StatusCreated)
 		w.Write(content)
 	})
 }
 
-type balanceRes struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
-}
-
-func balanceHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+func getAPIKeysHandler(accessManager *access.Manager) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value(userIDKey).(string)
 		if !ok || userID == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
-		current, withdrawn, err := bonusManager.GetBalance(ctx, userID)
+		keys, err := accessManager.GetAPIKeys(ctx, userID)
 		if err != nil {
-			logger.Error(fmt.Sprintf("get balance error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get api keys error: %w", err))
 			return
 		}
 
-		res := balanceRes{
-			Current:   float64(current) / 100,
-			Withdrawn: float64(withdrawn) / 100,
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
 		}
 
-		content, err := json.Marshal(res)
+		resItems := make([]apiKeyRes, 0, len(keys))
+		for _, key := range keys {
+			resItems = append(resItems, newAPIKeyRes(key))
+		}
+
+		content, err := json.Marshal(resItems)
 		if err != nil {
-			logger.Error(fmt.Sprintf("json marshall error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
 			return
 		}
 
@@ -258,115 +452,1324 @@ func balanceHandler(bonusManager *bonus.Manager) http.HandlerFunc {
 	})
 }
 
-type withdrawReq struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
-}
-
-func withdrawHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+func revokeAPIKeyHandler(accessManager *access.Manager) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := uuidParam(r)
+		if !ok {
+			writeError(w, http.StatusNotFound, access.ErrAPIKeyNotFound)
+			return
+		}
+
 		userID, ok := r.Context().Value(userIDKey).(string)
 		if !ok || userID == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
 			return
 		}
 
-		var withdraw withdrawReq
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
 
-		content, err := io.ReadAll(r.Body)
+		err := accessManager.RevokeAPIKey(ctx, userID, id)
+		if errors.Is(err, access.ErrAPIKeyNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
 		if err != nil {
-			logger.Error(fmt.Sprintf("body read error: %s", err))
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("revoke api key error: %w", err))
 			return
 		}
 
-		err = json.Unmarshal(content, &withdraw)
-		if err != nil {
-			logger.Error(fmt.Sprintf("json unmarshall error: %s", err))
-			w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// uuidParam returns the {id} path parameter if it is a UUID. Anything else
+// can't name a row, so it is answered with 404 without a query.
+func uuidParam(r *http.Request) (string, bool) {
+	id := chi.URLParam(r, "id")
+	if len(id) != 36 {
+		return "", false
+	}
+
+	for i, c := range id {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return "", false
+			}
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return "", false
+		}
+	}
+
+	return id, true
+}
+
+func isPolicyError(err error) bool {
+	return errors.Is(err, access.ErrLoginFormat) ||
+		errors.Is(err, access.ErrPasswordTooShort) ||
+		errors.Is(err, access.ErrPasswordTooLong) ||
+		errors.Is(err, access.ErrPasswordTooWeak)
+}
+
+func postOrderHandler(bonusManager *bonus.Manager, taskDispatcher *queue.Dispatcher) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
 			return
 		}
 
-		if withdraw.Order == "" || withdraw.Sum == 0 {
-			logger.Error("wrong json structure")
-			w.WriteHeader(http.StatusBadRequest)
+		content, err := readBody(r)
+		if err != nil {
+			writeBodyError(w, err)
 			return
 		}
 
-		intOrder, err := strconv.Atoi(withdraw.Order)
-		if err != nil || intOrder <= 0 {
-			w.WriteHeader(http.StatusBadRequest)
+		orderID := strings.TrimSpace(string(content))
+		err = bonus.ValidateOrderNumber(orderID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
-		err = bonusManager.Withdraw(ctx, userID, intOrder, int(withdraw.Sum*100))
-		if errors.Is(err, bonus.ErrWrongSum) {
-			w.WriteHeader(http.StatusBadRequest)
+		err = bonusManager.AddOrder(ctx, userID, orderID)
+		if errors.Is(err, bonus.ErrUserHasOrder) {
+			w.WriteHeader(http.StatusOK)
 			return
 		}
-		if errors.Is(err, bonus.ErrNotEnough) {
-			w.WriteHeader(http.StatusPaymentRequired)
+		if errors.Is(err, bonus.ErrOrderExists) {
+			writeError(w, http.StatusConflict, err)
 			return
 		}
-		if errors.Is(err, bonus.ErrLuhnAlgo) || errors.Is(err, bonus.ErrOrderExists) {
-			w.WriteHeader(http.StatusUnprocessableEntity)
+		if errors.Is(err, bonus.ErrLuhnAlgo) {
+			writeError(w, http.StatusUnprocessableEntity, err)
 			return
 		}
 		if err != nil {
-			logger.Error(fmt.Sprintf("withdraw error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("add order error: %w", err))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		taskDispatcher.Push(tasks.NewAccrualTask(tenant.FromContext(r.Context()), orderID))
+
+		w.WriteHeader(http.StatusAccepted)
 	})
 }
 
-type withdrawRes struct {
-	Order       string  `json:"order"`
-	Sum         float64 `json:"sum"`
-	ProcessedAt string  `json:"processed_at"`
+const maxBatchSize = 1000
+
+const (
+	resultAccepted       = "accepted"
+	resultAlreadyYours   = "already_uploaded"
+	resultOwnedByAnother = "uploaded_by_another_user"
+	resultLuhnFailed     = "luhn_check_failed"
+	resultInvalidNumber  = "invalid_number"
+)
+
+type batchOrderRes struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+	Status int    `json:"status"`
 }
 
-func withdrawalsHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+func batchOrdersHandler(bonusManager *bonus.Manager, taskDispatcher *queue.Dispatcher) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value(userIDKey).(string)
 		if !ok || userID == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
-		defer cancel()
-
-		withdrawals, err := bonusManager.GetWithdrawals(ctx, userID)
+		numbers, err := readBatchNumbers(r)
+		if errors.Is(err, errContentType) {
+			writeError(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
 		if err != nil {
-			logger.Error(fmt.Sprintf("get orders error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeBodyError(w, err)
 			return
 		}
 
-		if len(withdrawals) == 0 {
-			w.WriteHeader(http.StatusNoContent)
+		if len(numbers) == 0 {
+			writeError(w, http.StatusBadRequest, errBatchEmpty)
 			return
 		}
 
-		resItems := make([]withdrawRes, 0, len(withdrawals))
-		for _, withdrawal := range withdrawals {
-			resItems = append(resItems, withdrawRes{
-				Order:       strconv.Itoa(withdrawal.ID),
-				Sum:         float64(withdrawal.Sum) / 100,
-				ProcessedAt: withdrawal.CreatedAt.Format(time.RFC3339),
-			})
+		if len(numbers) > maxBatchSize {
+			writeError(w, http.StatusRequestEntityTooLarge, errBatchTooLarge)
+			return
+		}
+
+		resItems := make([]batchOrderRes, len(numbers))
+		orderIDs := make([]string, 0, len(numbers))
+		positions := make([]int, 0, len(numbers))
+
+		for i, number := range numbers {
+			resItems[i].Number = number
+
+			err := bonus.ValidateOrderNumber(number)
+			if err != nil {
+				resItems[i].Result = resultInvalidNumber
+				resItems[i].Status = http.StatusBadRequest
+				continue
+			}
+
+			orderIDs = append(orderIDs, number)
+			positions = append(positions, i)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var results []error
+		if len(orderIDs) > 0 {
+			results, err = bonusManager.AddOrders(ctx, userID, orderIDs)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("add orders error: %w", err))
+				return
+			}
 		}
 
+		accrualTasks := make([]*queue.Task, 0, len(orderIDs))
+		for i, result := range results {
+			item := &resItems[positions[i]]
+
+			switch {
+			case result == nil:
+				item.Result, item.Status = resultAccepted, http.StatusAccepted
+				accrualTasks = append(accrualTasks, tasks.NewAccrualTask(tenant.FromContext(r.Context()), orderIDs[i]))
+			case errors.Is(result, bonus.ErrUserHasOrder):
+				item.Result, item.Status = resultAlreadyYours, http.StatusOK
+			case errors.Is(result, bonus.ErrOrderExists):
+				item.Result, item.Status = resultOwnedByAnother, http.StatusConflict
+			case errors.Is(result, bonus.ErrLuhnAlgo):
+				item.Result, item.Status = resultLuhnFailed, http.StatusUnprocessableEntity
+			}
+		}
+
+		taskDispatcher.PushMany(accrualTasks)
+
 		content, err := json.Marshal(resItems)
 		if err != nil {
-			logger.Error(fmt.Sprintf("json marshall error: %s", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+func readBatchNumbers(r *http.Request) ([]string, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(contTypeHeader))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errContentType, err)
+	}
+
+	content, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaType == textCSV {
+		reader := csv.NewReader(bytes.NewReader(content))
+		reader.FieldsPerRecord = -1
+
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidCSV, err)
+		}
+
+		numbers := make([]string, 0, len(records))
+		for _, record := range records {
+			number := strings.TrimSpace(record[0])
+			if number == "" {
+				continue
+			}
+			numbers = append(numbers, number)
+		}
+
+		return numbers, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var items []interface{}
+	err = decoder.Decode(&items)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidJSON, err)
+	}
+
+	err = checkJSONEnd(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			numbers = append(numbers, v)
+		case json.Number:
+			numbers = append(numbers, v.String())
+		default:
+			numbers = append(numbers, fmt.Sprint(v))
+		}
+	}
+
+	return numbers, nil
+}
+
+type orderRes struct {
+	Number     string  `json:"number"`
+	Status     string  `json:"status"`
+	Accrual    float64 `json:"accrual,omitempty"`
+	UploadedAt string  `json:"uploaded_at"`
+}
+
+func getOrdersHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		orders, err := bonusManager.GetOrders(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get orders error: %w", err))
+			return
+		}
+
+		if len(orders) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		resItems := make([]orderRes, 0, len(orders))
+		for _, order := range orders {
+			resItems = append(resItems, orderRes{
+				Number:     order.ID,
+				Status:     order.Status,
+				Accrual:    float64(order.Accrual) / 100,
+				UploadedAt: order.CreatedAt.Format(time.RFC3339),
+			})
+		}
+
+		content, err := json.Marshal(resItems)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+type orderDetailsRes struct {
+	Number     string  `json:"number"`
+	Status     string  `json:"status"`
+	Accrual    float64 `json:"accrual,omitempty"`
+	UploadedAt string  `json:"uploaded_at"`
+	CheckedAt  string  `json:"checked_at,omitempty"`
+	Attempts   int     `json:"attempts"`
+}
+
+func getOrderHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		orderID := chi.URLParam(r, "number")
+		err := bonus.ValidateOrderNumber(orderID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		order, err := bonusManager.GetOrder(ctx, userID, orderID)
+		if errors.Is(err, bonus.ErrOrderNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get order error: %w", err))
+			return
+		}
+
+		res := orderDetailsRes{
+			Number:     order.ID,
+			Status:     order.Status,
+			Accrual:    float64(order.Accrual) / 100,
+			UploadedAt: order.CreatedAt.Format(time.RFC3339),
+			Attempts:   order.Attempts,
+		}
+		if !order.CheckedAt.IsZero() {
+			res.CheckedAt = order.CheckedAt.Format(time.RFC3339)
+		}
+
+		content, err := json.Marshal(res)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+type tierRes struct {
+	Name           string   `json:"name"`
+	Multiplier     float64  `json:"multiplier"`
+	Bonus          float64  `json:"bonus,omitempty"`
+	RollingAccrual float64  `json:"rolling_accrual"`
+	NextTier       string   `json:"next_tier,omitempty"`
+	NextThreshold  *float64 `json:"next_threshold,omitempty"`
+	Progress       float64  `json:"progress"`
+}
+
+type balanceRes struct {
+	Current   float64  `json:"current"`
+	Withdrawn float64  `json:"withdrawn"`
+	Held      float64  `json:"held"`
+	Tier      *tierRes `json:"tier,omitempty"`
+}
+
+func newTierRes(status *bonus.TierStatus) *tierRes {
+	res := &tierRes{
+		Name:           status.Tier.Name,
+		Multiplier:     status.Tier.Multiplier,
+		Bonus:          float64(status.Tier.Bonus) / 100,
+		RollingAccrual: float64(status.RollingAccrual) / 100,
+		Progress:       1,
+	}
+
+	if status.Next != nil {
+		nextThreshold := float64(status.Next.Threshold) / 100
+		res.NextTier = status.Next.Name
+		res.NextThreshold = &nextThreshold
+
+		span := status.Next.Threshold - status.Tier.Threshold
+		if span > 0 {
+			res.Progress = math.Floor(float64(status.RollingAccrual-status.Tier.Threshold)/float64(span)*100) / 100
+		}
+		res.Progress = math.Max(0, math.Min(1, res.Progress))
+	}
+
+	return res
+}
+
+func balanceHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		current, withdrawn, held, err := bonusManager.GetBalance(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get balance error: %w", err))
+			return
+		}
+
+		tierStatus, err := bonusManager.GetTier(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get tier error: %w", err))
+			return
+		}
+
+		res := balanceRes{
+			Current:   float64(current) / 100,
+			Withdrawn: float64(withdrawn) / 100,
+			Held:      float64(held) / 100,
+			Tier:      newTierRes(tierStatus),
+		}
+
+		content, err := json.Marshal(res)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+type withdrawReq struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
+
+func withdrawHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		var withdraw withdrawReq
+
+		err := decodeJSON(r, &withdraw)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+
+		if withdraw.Order == "" || withdraw.Sum == 0 {
+			writeError(w, http.StatusBadRequest, errMissingField)
+			return
+		}
+
+		err = bonus.ValidateOrderNumber(withdraw.Order)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		err = bonusManager.Withdraw(ctx, userID, withdraw.Order, int(withdraw.Sum*100))
+		if errors.Is(err, bonus.ErrWrongSum) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrNotEnough) {
+			writeError(w, http.StatusPaymentRequired, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrLuhnAlgo) || errors.Is(err, bonus.ErrOrderExists) {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("withdraw error: %w", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+type withdrawRes struct {
+	Order       string  `json:"order"`
+	Sum         float64 `json:"sum"`
+	ProcessedAt string  `json:"processed_at"`
+}
+
+func withdrawalsHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		withdrawals, err := bonusManager.GetWithdrawals(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get orders error: %w", err))
+			return
+		}
+
+		if len(withdrawals) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		resItems := make([]withdrawRes, 0, len(withdrawals))
+		for _, withdrawal := range withdrawals {
+			resItems = append(resItems, withdrawRes{
+				Order:       withdrawal.ID,
+				Sum:         float64(withdrawal.Sum) / 100,
+				ProcessedAt: withdrawal.CreatedAt.Format(time.RFC3339),
+			})
+		}
+
+		content, err := json.Marshal(resItems)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+type holdRes struct {
+	ID         string  `json:"id"`
+	Order      string  `json:"order"`
+	Sum        float64 `json:"sum"`
+	Status     string  `json:"status"`
+	CreatedAt  string  `json:"created_at"`
+	ExpiresAt  string  `json:"expires_at"`
+	FinishedAt string  `json:"finished_at,omitempty"`
+}
+
+func newHoldRes(h *bonus.Hold) holdRes {
+	res := holdRes{
+		ID:        h.ID,
+		Order:     h.OrderID,
+		Sum:       float64(h.Amount) / 100,
+		Status:    h.Status,
+		CreatedAt: h.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: h.ExpiresAt.Format(time.RFC3339),
+	}
+
+	if !h.FinishedAt.IsZero() {
+		res.FinishedAt = h.FinishedAt.Format(time.RFC3339)
+	}
+
+	return res
+}
+
+func writeHold(w http.ResponseWriter, status int, h *bonus.Hold) {
+	content, err := json.Marshal(newHoldRes(h))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+		return
+	}
+
+	w.Header().Add(contTypeHeader, appJSON)
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+func holdHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		var hold withdrawReq
+
+		err := decodeJSON(r, &hold)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+
+		if hold.Order == "" || hold.Sum == 0 {
+			writeError(w, http.StatusBadRequest, errMissingField)
+			return
+		}
+
+		err = bonus.ValidateOrderNumber(hold.Order)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		h, err := bonusManager.Hold(ctx, userID, hold.Order, int(math.Round(hold.Sum*100)))
+		if errors.Is(err, bonus.ErrWrongSum) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrNotEnough) {
+			writeError(w, http.StatusPaymentRequired, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrLuhnAlgo) || errors.Is(err, bonus.ErrOrderExists) {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("hold error: %w", err))
+			return
+		}
+
+		writeHold(w, http.StatusCreated, h)
+	})
+}
+
+func captureHoldHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := uuidParam(r)
+		if !ok {
+			writeError(w, http.StatusNotFound, bonus.ErrHoldNotFound)
+			return
+		}
+
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		h, err := bonusManager.CaptureHold(ctx, userID, id)
+		if errors.Is(err, bonus.ErrHoldNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrHoldExpired) {
+			writeError(w, http.StatusGone, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrOrderExists) {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("capture hold error: %w", err))
+			return
+		}
+
+		writeHold(w, http.StatusOK, h)
+	})
+}
+
+func releaseHoldHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := uuidParam(r)
+		if !ok {
+			writeError(w, http.StatusNotFound, bonus.ErrHoldNotFound)
+			return
+		}
+
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		h, err := bonusManager.ReleaseHold(ctx, userID, id)
+		if errors.Is(err, bonus.ErrHoldNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("release hold error: %w", err))
+			return
+		}
+
+		writeHold(w, http.StatusOK, h)
+	})
+}
+
+type transferReq struct {
+	To  string  `json:"to"`
+	Sum float64 `json:"sum"`
+}
+
+type transferRes struct {
+	ID          string  `json:"id"`
+	Direction   string  `json:"direction"`
+	Login       string  `json:"login"`
+	Sum         float64 `json:"sum"`
+	Status      string  `json:"status"`
+	CreatedAt   string  `json:"created_at"`
+	ExpiresAt   string  `json:"expires_at,omitempty"`
+	CompletedAt string  `json:"completed_at,omitempty"`
+}
+
+func newTransferRes(userID string, t *bonus.Transfer) transferRes {
+	res := transferRes{
+		ID:        t.ID,
+		Direction: "out",
+		Login:     t.RecipientLogin,
+		Sum:       float64(t.Amount) / 100,
+		Status:    t.Status,
+		CreatedAt: t.CreatedAt.Format(time.RFC3339),
+	}
+
+	if t.RecipientID == userID {
+		res.Direction = "in"
+		res.Login = t.SenderLogin
+	}
+
+	if t.Status == bonus.TransferPending {
+		res.ExpiresAt = t.ExpiresAt.Format(time.RFC3339)
+	} else {
+		res.CompletedAt = t.CompletedAt.Format(time.RFC3339)
+	}
+
+	return res
+}
+
+func transferHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		var transfer transferReq
+
+		err := decodeJSON(r, &transfer)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+
+		if transfer.To == "" || transfer.Sum == 0 {
+			writeError(w, http.StatusBadRequest, errMissingField)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		t, err := bonusManager.CreateTransfer(ctx, userID, transfer.To, int(math.Round(transfer.Sum*100)))
+		if errors.Is(err, bonus.ErrWrongSum) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrNotEnough) {
+			writeError(w, http.StatusPaymentRequired, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrRecipientNotFound) || errors.Is(err, bonus.ErrTransferLimit) {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("create transfer error: %w", err))
+			return
+		}
+
+		content, err := json.Marshal(newTransferRes(userID, t))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(content)
+	})
+}
+
+func confirmTransferHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := uuidParam(r)
+		if !ok {
+			writeError(w, http.StatusNotFound, bonus.ErrTransferNotFound)
+			return
+		}
+
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		t, err := bonusManager.ConfirmTransfer(ctx, userID, id)
+		if errors.Is(err, bonus.ErrTransferNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrTransferExpired) {
+			writeError(w, http.StatusGone, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrNotEnough) {
+			writeError(w, http.StatusPaymentRequired, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrTransferLimit) {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("confirm transfer error: %w", err))
+			return
+		}
+
+		content, err := json.Marshal(newTransferRes(userID, t))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+func transfersHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		transfers, err := bonusManager.GetTransfers(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get transfers error: %w", err))
+			return
+		}
+
+		if len(transfers) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		resItems := make([]transferRes, 0, len(transfers))
+		for _, t := range transfers {
+			resItems = append(resItems, newTransferRes(userID, t))
+		}
+
+		content, err := json.Marshal(resItems)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
+
+func statementHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		query := r.URL.Query()
+
+		from, to, err := statement.ParsePeriod(query.Get("from"), query.Get("to"), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		format := query.Get("format")
+		if format == "" {
+			format = statement.FormatJSON
+		}
+
+		out := &startedWriter{w: w}
+		sink, err := statement.NewWriter(format, out, userID, from, to)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		w.Header().Add(contTypeHeader, statement.ContentType(format))
+
+		err = bonusManager.Statement(ctx, userID, from, to, sink)
+		if errors.Is(err, bonus.ErrWrongPeriod) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err == nil {
+			err = sink.Flush()
+		}
+		if err != nil && out.started {
+			logger.Error(fmt.Sprintf("statement error: %s", err))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("statement error: %w", err))
+			return
+		}
+	})
+}
+
+type campaignConditions struct {
+	MinOrders  int      `json:"min_orders,omitempty"`
+	MaxOrders  int      `json:"max_orders,omitempty"`
+	Tiers      []string `json:"tiers,omitempty"`
+	MinAccrual float64  `json:"min_accrual,omitempty"`
+}
+
+type campaignActions struct {
+	Multiplier float64 `json:"multiplier,omitempty"`
+	Bonus      float64 `json:"bonus,omitempty"`
+}
+
+type campaignDTO struct {
+	ID         string             `json:"id,omitempty"`
+	Name       string             `json:"name"`
+	StartsAt   *time.Time         `json:"starts_at,omitempty"`
+	EndsAt     *time.Time         `json:"ends_at,omitempty"`
+	Active     *bool              `json:"active,omitempty"`
+	Conditions campaignConditions `json:"conditions"`
+	Actions    campaignActions    `json:"actions"`
+	CreatedAt  *time.Time         `json:"created_at,omitempty"`
+}
+
+func (d *campaignDTO) campaign() *bonus.Campaign {
+	c := &bonus.Campaign{
+		Name:       d.Name,
+		MinOrders:  d.Conditions.MinOrders,
+		MaxOrders:  d.Conditions.MaxOrders,
+		Tiers:      d.Conditions.Tiers,
+		MinAccrual: int(math.Round(d.Conditions.MinAccrual * 100)),
+		Multiplier: d.Actions.Multiplier,
+		Bonus:      int(math.Round(d.Actions.Bonus * 100)),
+		Active:     d.Active == nil || *d.Active,
+	}
+	if c.Tiers == nil {
+		c.Tiers = []string{}
+	}
+	if d.StartsAt != nil {
+		c.StartsAt = *d.StartsAt
+	}
+	if d.EndsAt != nil {
+		c.EndsAt = *d.EndsAt
+	}
+
+	return c
+}
+
+func newCampaignDTO(c *bonus.Campaign) *campaignDTO {
+	active := c.Active
+	createdAt := c.CreatedAt
+
+	d := &campaignDTO{
+		ID:     c.ID,
+		Name:   c.Name,
+		Active: &active,
+		Conditions: campaignConditions{
+			MinOrders:  c.MinOrders,
+			MaxOrders:  c.MaxOrders,
+			Tiers:      c.Tiers,
+			MinAccrual: float64(c.MinAccrual) / 100,
+		},
+		Actions: campaignActions{
+			Multiplier: c.Multiplier,
+			Bonus:      float64(c.Bonus) / 100,
+		},
+		CreatedAt: &createdAt,
+	}
+	if !c.StartsAt.IsZero() {
+		startsAt := c.StartsAt
+		d.StartsAt = &startsAt
+	}
+	if !c.EndsAt.IsZero() {
+		endsAt := c.EndsAt
+		d.EndsAt = &endsAt
+	}
+
+	return d
+}
+
+func readCampaign(r *http.Request) (*bonus.Campaign, error) {
+	var req campaignDTO
+
+	err := decodeJSON(r, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	return req.campaign(), nil
+}
+
+func createCampaignHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		campaign, err := readCampaign(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		err = bonusManager.CreateCampaign(ctx, campaign)
+		if errors.Is(err, bonus.ErrCampaignRule) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("create campaign error: %w", err))
+			return
+		}
+
+		content, err := json.Marshal(newCampaignDTO(campaign))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(content)
+	})
+}
+
+func getCampaignsHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		campaigns, err := bonusManager.GetCampaigns(ctx)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get campaigns error: %w", err))
+			return
+		}
+
+		resItems := make([]*campaignDTO, 0, len(campaigns))
+		for _, campaign := range campaigns {
+			resItems = append(resItems, newCampaignDTO(campaign))
+		}
+
+		content, err := json.Marshal(resItems)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+func getCampaignHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := uuidParam(r)
+		if !ok {
+			writeError(w, http.StatusNotFound, bonus.ErrCampaignNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		campaign, err := bonusManager.GetCampaign(ctx, id)
+		if errors.Is(err, bonus.ErrCampaignNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get campaign error: %w", err))
+			return
+		}
+
+		content, err := json.Marshal(newCampaignDTO(campaign))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+func updateCampaignHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := uuidParam(r)
+		if !ok {
+			writeError(w, http.StatusNotFound, bonus.ErrCampaignNotFound)
+			return
+		}
+
+		campaign, err := readCampaign(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		campaign.ID = id
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		err = bonusManager.UpdateCampaign(ctx, campaign)
+		if errors.Is(err, bonus.ErrCampaignRule) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, bonus.ErrCampaignNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("update campaign error: %w", err))
+			return
+		}
+
+		campaign, err = bonusManager.GetCampaign(ctx, campaign.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get campaign error: %w", err))
+			return
+		}
+
+		content, err := json.Marshal(newCampaignDTO(campaign))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
+			return
+		}
+
+		w.Header().Add(contTypeHeader, appJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+	})
+}
+
+func stopCampaignHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := uuidParam(r)
+		if !ok {
+			writeError(w, http.StatusNotFound, bonus.ErrCampaignNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		err := bonusManager.StopCampaign(ctx, id)
+		if errors.Is(err, bonus.ErrCampaignNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("stop campaign error: %w", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+const (
+	referralPending  = "pending"
+	referralRewarded = "rewarded"
+	referralExpired  = "expired"
+)
+
+type referralItemRes struct {
+	Login        string  `json:"login"`
+	RegisteredAt string  `json:"registered_at"`
+	Status       string  `json:"status"`
+	Reward       float64 `json:"reward"`
+}
+
+type referralsRes struct {
+	Code      string            `json:"code"`
+	Earned    float64           `json:"earned"`
+	Referrals []referralItemRes `json:"referrals"`
+}
+
+func maskLogin(login string) string {
+	if len(login) <= 2 {
+		return "***"
+	}
+
+	return login[:2] + "***"
+}
+
+func referralsHandler(bonusManager *bonus.Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey).(string)
+		if !ok || userID == "" {
+			writeError(w, http.StatusUnauthorized, errTokenRequired)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		code, err := bonusManager.GetReferralCode(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get referral code error: %w", err))
+			return
+		}
+
+		referrals, err := bonusManager.GetReferrals(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("get referrals error: %w", err))
+			return
+		}
+
+		res := referralsRes{
+			Code:      code,
+			Referrals: make([]referralItemRes, 0, len(referrals)),
+		}
+
+		for _, referral := range referrals {
+			item := referralItemRes{
+				Login:        maskLogin(referral.RefereeLogin),
+				RegisteredAt: referral.CreatedAt.Format(time.RFC3339),
+				Status:       referralPending,
+			}
+
+			switch {
+			case !referral.RewardedAt.IsZero():
+				item.Status = referralRewarded
+				item.Reward = float64(referral.ReferrerReward) / 100
+			case bonusManager.ReferralExpired(referral):
+				item.Status = referralExpired
+			}
+
+			res.Earned += item.Reward
+			res.Referrals = append(res.Referrals, item)
+		}
+
+		content, err := json.Marshal(res)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("json marshall error: %w", err))
 			return
 		}
 
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDParam(t *testing.T) {
+	tests := []struct {
+		id string
+		ok bool
+	}{
+		{"6f1c2a4e-8d3b-4c5a-9e7f-0a1b2c3d4e5f", true},
+		{"6F1C2A4E-8D3B-4C5A-9E7F-0A1B2C3D4E5F", true},
+		{"", false},
+		{"6f1c2a4e8d3b4c5a9e7f0a1b2c3d4e5f", false},
+		{"6f1c2a4e-8d3b-4c5a-9e7f-0a1b2c3d4e5g", false},
+		{"6f1c2a4e-8d3b-4c5a-9e7f_0a1b2c3d4e5f", false},
+		{"' OR 1=1 --                         ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			id, ok := uuidParam(r)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.id, id)
+			}
+		})
+	}
+}
@@ -2,35 +2,139 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ruskiiamov/gophermart/internal/access"
-	"github.com/ruskiiamov/gophermart/internal/logger"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
 )
 
-func authMiddleware(accessManager *access.Manager) func(http.Handler) http.Handler {
+func tenantMiddleware(registry *tenant.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, err := registry.Resolve(r.Header.Get(tenant.Header), r.Host)
+			if err != nil {
+				writeError(w, http.StatusNotFound, errUnknownTenant)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), t.ID)))
+		})
+	}
+}
+
+// adminMiddleware checks the admin token. With clientCerts and no token, a
+// verified client certificate is enough.
+func adminMiddleware(adminToken string, clientCerts bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminToken == "" && clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if adminToken == "" {
+				writeError(w, http.StatusNotFound, errAdminDisabled)
+				return
+			}
+
+			token := r.Header.Get(adminTokenHeader)
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				writeError(w, http.StatusUnauthorized, errAdminToken)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitMiddleware(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retryAfter := limiter.Allow(clientIP(r))
+			if !ok {
+				writeTooManyRequests(w, retryAfter, errRateLimited)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, err error) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set(retryAfterHeader, strconv.Itoa(seconds))
+	writeError(w, http.StatusTooManyRequests, err)
+}
+
+func authMiddleware(accessManager *access.Manager, cookies CookieConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			accessToken := r.Header.Get(authHeader)
+			if accessToken == "" && cookies.Enabled {
+				var err error
+				accessToken, err = sessionToken(r)
+				if err != nil {
+					writeError(w, http.StatusForbidden, err)
+					return
+				}
+			}
 			if accessToken == "" {
-				w.WriteHeader(http.StatusUnauthorized)
+				writeError(w, http.StatusUnauthorized, errTokenRequired)
 				return
 			}
 
 			ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
 			defer cancel()
 
+			if access.IsAPIKey(accessToken) {
+				userID, scopes, err := accessManager.AuthByAPIKey(ctx, accessToken)
+				if errors.Is(err, access.ErrAPIKeyNotValid) {
+					writeError(w, http.StatusUnauthorized, err)
+					return
+				}
+				if err != nil {
+					writeError(w, http.StatusInternalServerError, fmt.Errorf("auth by api key error: %w", err))
+					return
+				}
+
+				rCtx := context.WithValue(r.Context(), userIDKey, userID)
+				rCtx = context.WithValue(rCtx, scopesKey, scopes)
+				next.ServeHTTP(w, r.Clone(rCtx))
+				return
+			}
+
 			userID, err := accessManager.AuthByToken(ctx, accessToken)
 			if errors.Is(err, access.ErrTokenNotValid) {
-				w.WriteHeader(http.StatusUnauthorized)
+				writeError(w, http.StatusUnauthorized, err)
 				return
 			}
 			if err != nil {
-				logger.Error(fmt.Sprintf("auth by token error: %s", err))
-				w.WriteHeader(http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("auth by token error: %w", err))
 				return
 			}
 
@@ -41,3 +145,78 @@ func authMiddleware(accessManager *access.Manager) func(http.Handler) http.Handl
 		})
 	}
 }
+
+func scopeMiddleware(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := r.Context().Value(scopesKey).([]string)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, s := range scopes {
+				if s == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			writeError(w, http.StatusForbidden, errScope)
+		})
+	}
+}
+
+func contentTypeMiddleware(contentTypes ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]struct{}, len(contentTypes))
+	for _, t := range contentTypes {
+		allowed[t] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get(contTypeHeader))
+			if _, ok := allowed[mediaType]; err != nil || !ok {
+				writeError(w, http.StatusUnsupportedMediaType, errContentType)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bodyLimitMiddleware(limits BodyLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := limits.Default
+			if strings.TrimSuffix(r.URL.Path, "/") == batchOrdersPath {
+				limit = limits.Batch
+			}
+
+			if r.ContentLength > limit {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("%w: limit is %d bytes", errBodyTooLarge, limit))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(scopesKey).([]string); ok {
+			writeError(w, http.StatusForbidden, errSessionRequired)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
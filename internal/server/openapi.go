@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/ruskiiamov/gophermart/internal/logger"
+)
+
+//go:embed openapi.json
+var openapiSpec []byte
+
+func loadOpenAPI() (*openapi3.T, routers.Router, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openapiSpec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("openapi load error: %w", err)
+	}
+
+	err = doc.Validate(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("openapi validate error: %w", err)
+	}
+
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("openapi router error: %w", err)
+	}
+
+	return doc, router, nil
+}
+
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add(contTypeHeader, appJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapiSpec)
+}
+
+// openapiMiddleware rejects requests not matching the spec. Requests with a
+// Content-Type the operation does not declare are passed through, so the
+// route answers them with 415 itself.
+func openapiMiddleware(router routers.Router, validateResponses bool) func(http.Handler) http.Handler {
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         true,
+	}
+	noBodyOptions := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         true,
+		ExcludeRequestBody: true,
+	}
+	responseOptions := &openapi3filter.Options{
+		IncludeResponseStatus: true,
+		MultiError:            true,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}
+
+			if !declaresContentType(route.Operation, r) {
+				input.Options = noBodyOptions
+			}
+
+			err = openapi3filter.ValidateRequest(r.Context(), input)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("%w: limit is %d bytes", errBodyTooLarge, maxBytesErr.Limit))
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %s", errValidation, err))
+				return
+			}
+
+			if !validateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 rec.status,
+				Header:                 w.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(rec.body.Bytes())),
+				Options:                responseOptions,
+			})
+			if err != nil {
+				logger.Error(fmt.Sprintf("%s %s response does not match openapi: %s", r.Method, r.URL.Path, err))
+			}
+		})
+	}
+}
+
+func declaresContentType(operation *openapi3.Operation, r *http.Request) bool {
+	if operation.RequestBody == nil || operation.RequestBody.Value == nil {
+		return true
+	}
+
+	contentType := r.Header.Get(contTypeHeader)
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return operation.RequestBody.Value.Content.Get(mediaType) != nil
+}
+
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *http.Server {
+	tenants, err := tenant.NewRegistry(&tenant.Tenant{ID: tenant.DefaultID})
+	require.NoError(t, err)
+
+	limiters := ratelimit.Limiters{
+		Register: ratelimit.NewLimiter(100, time.Minute),
+		Login:    ratelimit.NewLimiter(100, time.Minute),
+		OIDC:     ratelimit.NewLimiter(100, time.Minute),
+		Account:  ratelimit.NewLimiter(100, time.Minute),
+	}
+
+	return NewServer(context.Background(), "", nil, nil, nil, limiters, tenants, "", false, BodyLimits{
+		Default: 1024,
+		Batch:   4096,
+	}, Timeouts{}, CORSConfig{
+		AllowedOrigins: []string{"https://shop.example.com"},
+		MaxAge:         10 * time.Minute,
+	}, CookieConfig{
+		Enabled:  true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}, 0)
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	doc, _, err := loadOpenAPI()
+	require.NoError(t, err)
+
+	specOps := make(map[string]struct{})
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			specOps[method+" "+path] = struct{}{}
+		}
+	}
+
+	routes, ok := newTestServer(t).Handler.(chi.Routes)
+	require.True(t, ok)
+
+	routedOps := make(map[string]struct{})
+	err = chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.ReplaceAll(route, "/*/", "/")
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		routedOps[method+" "+route] = struct{}{}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, sortedKeys(specOps), sortedKeys(routedOps))
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	handler := newTestServer(t).Handler
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{
+			name:        "missing password",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: appJSON,
+			body:        `{"login":"user"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "wrong field type",
+			method:      http.MethodPost,
+			path:        "/api/user/login",
+			contentType: appJSON,
+			body:        `{"login":"user","password":42}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "undeclared content type",
+			method:      http.MethodPost,
+			path:        "/api/user/login",
+			contentType: "text/plain",
+			body:        `login`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:   "spec",
+			method: http.MethodGet,
+			path:   "/api/openapi.json",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set(contTypeHeader, tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
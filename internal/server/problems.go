@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ruskiiamov/gophermart/internal/access"
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/logger"
+	"github.com/ruskiiamov/gophermart/internal/statement"
+)
+
+const (
+	appProblemJSON    = "application/problem+json"
+	problemTypePrefix = "urn:gophermart:problem:"
+)
+
+var (
+	errReadBody         = errors.New("request body read error")
+	errInvalidJSON      = errors.New("request body is not valid json")
+	errInvalidCSV       = errors.New("request body is not valid csv")
+	errMissingField     = errors.New("required field is missing")
+	errBodyTooLarge     = errors.New("request body too large")
+	errTokenRequired    = errors.New("access token required")
+	errScope            = errors.New("api key scope does not allow this operation")
+	errSessionRequired  = errors.New("operation requires a user session")
+	errCSRF             = errors.New("csrf token missing or invalid")
+	errUnknownTenant    = errors.New("unknown tenant")
+	errAdminDisabled    = errors.New("admin api disabled")
+	errAdminToken       = errors.New("wrong admin token")
+	errRateLimited      = errors.New("too many requests")
+	errContentType      = errors.New("unsupported content type")
+	errBatchEmpty       = errors.New("no order numbers in batch")
+	errBatchTooLarge    = errors.New("too many order numbers in batch")
+	errNotFound         = errors.New("resource not found")
+	errMethodNotAllowed = errors.New("method not allowed")
+	errOIDCFailed       = errors.New("oidc login failed")
+	errValidation       = errors.New("request does not match the api schema")
+)
+
+// problemCodes maps errors to stable machine-readable codes. The first match wins.
+var problemCodes = []struct {
+	err  error
+	code string
+}{
+	{errReadBody, "body_read_failed"},
+	{errInvalidJSON, "invalid_json"},
+	{errInvalidCSV, "invalid_csv"},
+	{errMissingField, "missing_field"},
+	{errBodyTooLarge, "body_too_large"},
+	{errTokenRequired, "token_required"},
+	{errScope, "insufficient_scope"},
+	{errSessionRequired, "session_required"},
+	{errCSRF, "csrf_failed"},
+	{errUnknownTenant, "unknown_tenant"},
+	{errAdminDisabled, "admin_disabled"},
+	{errAdminToken, "admin_token_not_valid"},
+	{errRateLimited, "rate_limited"},
+	{errContentType, "unsupported_media_type"},
+	{errBatchEmpty, "empty_batch"},
+	{errBatchTooLarge, "batch_too_large"},
+	{errNotFound, "not_found"},
+	{errMethodNotAllowed, "method_not_allowed"},
+	{errOIDCFailed, "oidc_failed"},
+	{errValidation, "validation_failed"},
+	{access.ErrLoginExists, "login_exists"},
+	{access.ErrLoginPassword, "invalid_credentials"},
+	{access.ErrTokenNotValid, "token_not_valid"},
+	{access.ErrUserNotFound, "user_not_found"},
+	{access.ErrAPIKeyNotValid, "api_key_not_valid"},
+	{access.ErrAPIKeyNotFound, "api_key_not_found"},
+	{access.ErrAPIKeyName, "api_key_name"},
+	{access.ErrAPIKeyScopes, "api_key_scopes"},
+	{access.ErrLoginFormat, "login_format"},
+	{access.ErrPasswordTooShort, "password_too_short"},
+	{access.ErrPasswordTooLong, "password_too_long"},
+	{access.ErrPasswordTooWeak, "password_too_weak"},
+	{access.ErrOIDCDisabled, "oidc_disabled"},
+	{access.ErrOIDCState, "oidc_state"},
+	{access.ErrOIDCToken, "oidc_token"},
+	{access.ErrOIDCNotAvailable, "oidc_not_available"},
+	{bonus.ErrOrderExists, "order_exists"},
+	{bonus.ErrLuhnAlgo, "luhn_check_failed"},
+	{bonus.ErrOrderNumberFormat, "invalid_order_number"},
+	{bonus.ErrOrderNumberLength, "order_number_too_long"},
+	{bonus.ErrNotEnough, "not_enough_points"},
+	{bonus.ErrOrderNotFound, "order_not_found"},
+	{bonus.ErrWrongSum, "wrong_sum"},
+	{bonus.ErrWrongPeriod, "wrong_period"},
+	{bonus.ErrCampaignNotFound, "campaign_not_found"},
+	{bonus.ErrCampaignRule, "campaign_rule"},
+	{bonus.ErrReferralCode, "referral_code"},
+	{bonus.ErrTransferNotFound, "transfer_not_found"},
+	{bonus.ErrTransferExpired, "transfer_expired"},
+	{bonus.ErrTransferLimit, "transfer_limit"},
+	{bonus.ErrRecipientNotFound, "recipient_not_found"},
+	{bonus.ErrHoldNotFound, "hold_not_found"},
+	{bonus.ErrHoldExpired, "hold_expired"},
+	{statement.ErrPeriodFormat, "period_format"},
+	{statement.ErrPeriodLength, "period_length"},
+	{statement.ErrUnknownFormat, "unknown_format"},
+}
+
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func problemCode(err error) (string, bool) {
+	var errLoginLocked *access.ErrLoginLocked
+	if errors.As(err, &errLoginLocked) {
+		return "login_locked", true
+	}
+
+	for _, c := range problemCodes {
+		if errors.Is(err, c.err) {
+			return c.code, true
+		}
+	}
+
+	return "", false
+}
+
+// writeError is the only way handlers and middlewares report failures. Server
+// errors are logged and their details are never sent to the client.
+func writeError(w http.ResponseWriter, status int, err error) {
+	p := problem{
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+
+	code, known := problemCode(err)
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		logger.Error(err.Error())
+		if !known {
+			code = "internal_error"
+		}
+	case known:
+		p.Detail = err.Error()
+	default:
+		code = strings.ReplaceAll(strings.ToLower(p.Title), " ", "_")
+		p.Detail = err.Error()
+	}
+
+	p.Code = code
+	p.Type = problemTypePrefix + code
+
+	content, err := json.Marshal(p)
+	if err != nil {
+		logger.Error(fmt.Sprintf("json marshall error: %s", err))
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(contTypeHeader, appProblemJSON)
+	w.WriteHeader(status)
+	w.Write(content)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/access"
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		code   string
+		detail string
+	}{
+		{
+			name:   "bonus error",
+			status: http.StatusUnprocessableEntity,
+			err:    bonus.ErrLuhnAlgo,
+			code:   "luhn_check_failed",
+			detail: bonus.ErrLuhnAlgo.Error(),
+		},
+		{
+			name:   "wrapped error",
+			status: http.StatusPaymentRequired,
+			err:    fmt.Errorf("withdraw: %w", bonus.ErrNotEnough),
+			code:   "not_enough_points",
+			detail: "withdraw: " + bonus.ErrNotEnough.Error(),
+		},
+		{
+			name:   "access error",
+			status: http.StatusUnauthorized,
+			err:    access.ErrTokenNotValid,
+			code:   "token_not_valid",
+			detail: access.ErrTokenNotValid.Error(),
+		},
+		{
+			name:   "login locked",
+			status: http.StatusTooManyRequests,
+			err:    &access.ErrLoginLocked{LockedUntil: time.Now().Add(time.Minute)},
+			code:   "login_locked",
+		},
+		{
+			name:   "unknown client error",
+			status: http.StatusBadRequest,
+			err:    errors.New("something odd"),
+			code:   "bad_request",
+			detail: "something odd",
+		},
+		{
+			name:   "server error hides detail",
+			status: http.StatusInternalServerError,
+			err:    fmt.Errorf("db error: %w", errors.New("connection refused")),
+			code:   "internal_error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, tt.status, tt.err)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, appProblemJSON, w.Header().Get(contTypeHeader))
+
+			var p problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+			assert.Equal(t, tt.status, p.Status)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, problemTypePrefix+tt.code, p.Type)
+			assert.Equal(t, http.StatusText(tt.status), p.Title)
+			if tt.detail != "" {
+				assert.Equal(t, tt.detail, p.Detail)
+			}
+			if tt.status >= http.StatusInternalServerError {
+				assert.Empty(t, p.Detail)
+			}
+		})
+	}
+}
+
+func TestServerProblems(t *testing.T) {
+	handler := newTestServer(t).Handler
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"validation", http.MethodPost, "/api/user/login", appJSON, `{"login":"user"}`, http.StatusBadRequest, "validation_failed"},
+		{"content type", http.MethodPost, "/api/user/login", "text/plain", "login", http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"no token", http.MethodGet, "/api/user/orders", "", "", http.StatusUnauthorized, "token_required"},
+		{"not found", http.MethodGet, "/api/unknown", "", "", http.StatusNotFound, "not_found"},
+		{"method not allowed", http.MethodDelete, "/api/openapi.json", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"admin disabled", http.MethodGet, "/api/admin/campaigns", "", "", http.StatusNotFound, "admin_disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set(contTypeHeader, tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, appProblemJSON, w.Header().Get(contTypeHeader))
+
+			var p problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+			assert.Equal(t, tt.code, p.Code)
+		})
+	}
+}
@@ -4,55 +4,206 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/ruskiiamov/gophermart/internal/access"
 	"github.com/ruskiiamov/gophermart/internal/bonus"
 	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/ratelimit"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
 )
 
 const (
-	contTypeHeader        = "Content-Type"
-	appJSON               = "application/json"
-	authHeader            = "Authorization"
-	userIDKey      ctxKey = "auth_user_id"
+	contTypeHeader          = "Content-Type"
+	appJSON                 = "application/json"
+	textCSV                 = "text/csv"
+	textPlain               = "text/plain"
+	authHeader              = "Authorization"
+	retryAfterHeader        = "Retry-After"
+	adminTokenHeader        = "X-Admin-Token"
+	oidcStateCookie         = "oidc_state"
+	userIDKey        ctxKey = "auth_user_id"
+	scopesKey        ctxKey = "auth_scopes"
+	batchOrdersPath         = "/api/user/orders/batch"
 )
 
 type ctxKey string
 
+type BodyLimits struct {
+	Default int64
+	Batch   int64
+}
+
+type Timeouts struct {
+	Read       time.Duration
+	ReadHeader time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
 func NewServer(
 	ctx context.Context,
 	address string,
 	accessManager *access.Manager,
 	bonusManager *bonus.Manager,
 	taskDispatcher *queue.Dispatcher,
+	limiters ratelimit.Limiters,
+	tenants *tenant.Registry,
+	adminToken string,
+	validateResponses bool,
+	bodyLimits BodyLimits,
+	timeouts Timeouts,
+	cors CORSConfig,
+	cookies CookieConfig,
+	cacheTTL time.Duration,
 ) *http.Server {
+	_, spec, err := loadOpenAPI()
+	if err != nil {
+		panic(err)
+	}
+
+	conditional := etagMiddleware(bonusManager, newResponseCache(cacheTTL))
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.Compress(5))
+	r.Use(corsMiddleware(cors))
+	r.Use(tenantMiddleware(tenants))
+	r.Use(bodyLimitMiddleware(bodyLimits))
+	r.Use(openapiMiddleware(spec, validateResponses))
+
+	r.NotFound(notFoundHandler)
+	r.MethodNotAllowed(methodNotAllowedHandler)
+
+	r.Get("/api/openapi.json", openapiHandler)
+
+	r.Get("/.well-known/jwks.json", jwksHandler(accessManager))
+
+	r.Route("/api/admin", adminRoutes(bonusManager, adminToken, false))
 
 	r.Route("/api/user", func(r chi.Router) {
-		r.With(middleware.AllowContentType(appJSON)).Post("/register", registerHnadler(accessManager))
-		r.With(middleware.AllowContentType(appJSON)).Post("/login", loginHandler(accessManager))
+		r.With(contentTypeMiddleware(appJSON), rateLimitMiddleware(limiters.Register)).
+			Post("/register", registerHnadler(accessManager, bonusManager, cookies))
+		r.With(contentTypeMiddleware(appJSON), rateLimitMiddleware(limiters.Login)).
+			Post("/login", loginHandler(accessManager, limiters.Account, cookies))
+		r.Post("/logout", logoutHandler(cookies))
+
+		r.Route("/oidc", func(r chi.Router) {
+			r.Use(rateLimitMiddleware(limiters.OIDC))
+			r.Get("/login", oidcLoginHandler(accessManager))
+			r.Get("/callback", oidcCallbackHandler(accessManager, cookies))
+		})
+
+		r.With(authMiddleware(accessManager, cookies)).Route("/", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(sessionMiddleware)
+
+				r.Delete("/", deleteUserHandler(accessManager))
+				r.With(contentTypeMiddleware(appJSON)).Post("/password", changePasswordHandler(accessManager, limiters.Account, cookies))
+
+				r.Route("/keys", func(r chi.Router) {
+					r.With(contentTypeMiddleware(appJSON)).Post("/", createAPIKeyHandler(accessManager))
+					r.Get("/", getAPIKeysHandler(accessManager))
+					r.Delete("/{id}", revokeAPIKeyHandler(accessManager))
+				})
+			})
 
-		r.With(authMiddleware(accessManager)).Route("/", func(r chi.Router) {
 			r.Route("/orders", func(r chi.Router) {
-				r.Post("/", postOrderHandler(bonusManager, taskDispatcher))
-				r.Get("/", getOrdersHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeOrdersWrite), contentTypeMiddleware(textPlain)).
+					Post("/", postOrderHandler(bonusManager, taskDispatcher))
+				r.With(scopeMiddleware(access.ScopeOrdersWrite), contentTypeMiddleware(appJSON, textCSV)).
+					Post("/batch", batchOrdersHandler(bonusManager, taskDispatcher))
+				r.With(scopeMiddleware(access.ScopeOrdersRead), conditional).Get("/", getOrdersHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeOrdersRead)).Get("/{number}", getOrderHandler(bonusManager))
 			})
 
 			r.Route("/balance", func(r chi.Router) {
-				r.Get("/", balanceHandler(bonusManager))
-				r.With(middleware.AllowContentType(appJSON)).Post("/withdraw", withdrawHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeBalanceRead), conditional).Get("/", balanceHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeBalanceWrite), contentTypeMiddleware(appJSON)).
+					Post("/withdraw", withdrawHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeBalanceWrite), contentTypeMiddleware(appJSON)).
+					Post("/holds", holdHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeBalanceWrite)).Post("/holds/{id}/capture", captureHoldHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeBalanceWrite)).Post("/holds/{id}/release", releaseHoldHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeBalanceWrite), contentTypeMiddleware(appJSON)).
+					Post("/transfer", transferHandler(bonusManager))
+				r.With(scopeMiddleware(access.ScopeBalanceWrite)).
+					Post("/transfer/{id}/confirm", confirmTransferHandler(bonusManager))
 			})
-			r.Get("/withdrawals", withdrawalsHandler(bonusManager))
+			r.With(scopeMiddleware(access.ScopeBalanceRead), conditional).Get("/withdrawals", withdrawalsHandler(bonusManager))
+			r.With(scopeMiddleware(access.ScopeBalanceRead)).Get("/transfers", transfersHandler(bonusManager))
+			r.With(scopeMiddleware(access.ScopeBalanceRead)).Get("/statement", statementHandler(bonusManager))
+			r.With(scopeMiddleware(access.ScopeBalanceRead)).Get("/referrals", referralsHandler(bonusManager))
 		})
 	})
 
+	return newHTTPServer(ctx, address, r, timeouts)
+}
+
+// NewAdminServer serves the admin API on its own listener, so that it can be
+// protected with client certificates.
+func NewAdminServer(
+	ctx context.Context,
+	address string,
+	bonusManager *bonus.Manager,
+	tenants *tenant.Registry,
+	adminToken string,
+	clientCerts bool,
+	bodyLimits BodyLimits,
+	timeouts Timeouts,
+) *http.Server {
+	_, spec, err := loadOpenAPI()
+	if err != nil {
+		panic(err)
+	}
+
+	r := chi.NewRouter()
+
+	r.Use(middleware.Compress(5))
+	r.Use(tenantMiddleware(tenants))
+	r.Use(bodyLimitMiddleware(bodyLimits))
+	r.Use(openapiMiddleware(spec, false))
+
+	r.NotFound(notFoundHandler)
+	r.MethodNotAllowed(methodNotAllowedHandler)
+
+	r.Route("/api/admin", adminRoutes(bonusManager, adminToken, clientCerts))
+
+	return newHTTPServer(ctx, address, r, timeouts)
+}
+
+func adminRoutes(bonusManager *bonus.Manager, adminToken string, clientCerts bool) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(adminMiddleware(adminToken, clientCerts))
+
+		r.Route("/campaigns", func(r chi.Router) {
+			r.With(contentTypeMiddleware(appJSON)).Post("/", createCampaignHandler(bonusManager))
+			r.Get("/", getCampaignsHandler(bonusManager))
+			r.Get("/{id}", getCampaignHandler(bonusManager))
+			r.With(contentTypeMiddleware(appJSON)).Put("/{id}", updateCampaignHandler(bonusManager))
+			r.Delete("/{id}", stopCampaignHandler(bonusManager))
+		})
+	}
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, errNotFound)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+}
+
+func newHTTPServer(ctx context.Context, address string, handler http.Handler, timeouts Timeouts) *http.Server {
 	return &http.Server{
-		Addr:    address,
-		Handler: r,
+		Addr:              address,
+		Handler:           handler,
+		ReadTimeout:       timeouts.Read,
+		ReadHeaderTimeout: timeouts.ReadHeader,
+		WriteTimeout:      timeouts.Write,
+		IdleTimeout:       timeouts.Idle,
 		BaseContext: func(_ net.Listener) context.Context {
 			return ctx
 		},
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAdminServer(t *testing.T) {
+	tenants, err := tenant.NewRegistry(&tenant.Tenant{ID: tenant.DefaultID})
+	require.NoError(t, err)
+
+	timeouts := Timeouts{Read: time.Second, ReadHeader: time.Second, Write: time.Second, Idle: time.Minute}
+	s := NewAdminServer(context.Background(), ":0", nil, tenants, "secret", false, BodyLimits{Default: 1024}, timeouts)
+
+	assert.Equal(t, time.Second, s.ReadHeaderTimeout)
+	assert.Equal(t, time.Minute, s.IdleTimeout)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"admin route", "/api/admin/campaigns", "wrong", http.StatusUnauthorized},
+		{"user route", "/api/user/orders", "secret", http.StatusNotFound},
+		{"malformed id", "/api/admin/campaigns/1%27%20OR%201=1", "secret", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set(adminTokenHeader, tt.token)
+			w := httptest.NewRecorder()
+			s.Handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+
+	tests := []struct {
+		name        string
+		adminToken  string
+		clientCerts bool
+		token       string
+		tls         *tls.ConnectionState
+		status      int
+	}{
+		{name: "disabled", status: http.StatusNotFound},
+		{name: "token", adminToken: "secret", token: "secret", status: http.StatusNoContent},
+		{name: "wrong token", adminToken: "secret", token: "wrong", status: http.StatusUnauthorized},
+		{name: "client cert", clientCerts: true, tls: verified, status: http.StatusNoContent},
+		{name: "client cert without tls", clientCerts: true, status: http.StatusNotFound},
+		{name: "client cert on main server", tls: verified, status: http.StatusNotFound},
+		{name: "token with client cert", adminToken: "secret", clientCerts: true, tls: verified, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/admin/campaigns", nil)
+			r.Header.Set(adminTokenHeader, tt.token)
+			r.TLS = tt.tls
+			w := httptest.NewRecorder()
+			adminMiddleware(tt.adminToken, tt.clientCerts)(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package statement
+
+import (
+	"errors"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// MaxPeriod bounds a single statement, the export streams the whole range.
+const MaxPeriod = 366 * 24 * time.Hour
+
+var (
+	ErrPeriodFormat = errors.New("wrong period format")
+	ErrPeriodLength = errors.New("statement period is too long")
+)
+
+// ParsePeriod accepts dates as YYYY-MM-DD or RFC3339. A date-only "to" covers
+// the whole day. Empty values default to the current month up to now. Periods
+// longer than MaxPeriod are rejected.
+func ParsePeriod(from, to string, now time.Time) (time.Time, time.Time, error) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := now
+
+	if from != "" {
+		t, _, err := parseTime(from, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		start = t
+	}
+
+	if to != "" {
+		t, dateOnly, err := parseTime(to, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		end = t
+	}
+
+	if end.Sub(start) > MaxPeriod {
+		return time.Time{}, time.Time{}, ErrPeriodLength
+	}
+
+	return start, end, nil
+}
+
+func parseTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(dateLayout, value, loc); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, ErrPeriodFormat
+	}
+
+	return t, false, nil
+}
@@ -0,0 +1,69 @@
+package statement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePeriod(t *testing.T) {
+	now := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		from, to string
+		start    time.Time
+		end      time.Time
+		err      error
+	}{
+		{
+			name:  "defaults",
+			start: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+			end:   now,
+		},
+		{
+			name:  "dates",
+			from:  "2023-01-01",
+			to:    "2023-01-31",
+			start: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "rfc3339",
+			from:  "2023-01-01T10:00:00Z",
+			to:    "2023-01-02T10:00:00Z",
+			start: time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC),
+			end:   time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "leap year",
+			from:  "2024-01-01",
+			to:    "2024-12-31",
+			start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "too long",
+			from: "2021-01-01",
+			to:   "2023-01-01",
+			err:  ErrPeriodLength,
+		},
+		{
+			name: "wrong format",
+			from: "01.01.2023",
+			err:  ErrPeriodFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := ParsePeriod(tt.from, tt.to, now)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.True(t, tt.start.Equal(start))
+				assert.True(t, tt.end.Equal(end))
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package statement
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+var ErrUnknownFormat = errors.New("unknown statement format")
+
+type Writer interface {
+	bonus.StatementSink
+	Flush() error
+}
+
+func NewWriter(format string, w io.Writer, userID string, from, to time.Time) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), from: from, to: to}, nil
+	case FormatJSON:
+		return &jsonWriter{w: bufio.NewWriter(w), userID: userID, from: from, to: to}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv"
+	}
+
+	return "application/json"
+}
+
+func amount(value int) string {
+	return strconv.FormatFloat(float64(value)/100, 'f', 2, 64)
+}
+
+type csvWriter struct {
+	w        *csv.Writer
+	from, to time.Time
+}
+
+func (c *csvWriter) Opening(balance int) error {
+	err := c.w.Write([]string{"date", "type", "order", "amount", "balance", "campaign"})
+	if err != nil {
+		return err
+	}
+
+	return c.w.Write([]string{c.from.Format(time.RFC3339), "opening_balance", "", "", amount(balance), ""})
+}
+
+func (c *csvWriter) Entry(entry *bonus.LedgerEntry, balance int) error {
+	return c.w.Write([]string{
+		entry.CreatedAt.Format(time.RFC3339),
+		entry.Type,
+		entry.OrderID,
+		amount(entry.Amount),
+		amount(balance),
+		entry.CampaignID,
+	})
+}
+
+func (c *csvWriter) Closing(balance int) error {
+	return c.w.Write([]string{c.to.Format(time.RFC3339), "closing_balance", "", "", amount(balance), ""})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonEntry struct {
+	Date     string      `json:"date"`
+	Type     string      `json:"type"`
+	Order    string      `json:"order"`
+	Amount   json.Number `json:"amount"`
+	Balance  json.Number `json:"balance"`
+	Campaign string      `json:"campaign,omitempty"`
+}
+
+type jsonWriter struct {
+	w        *bufio.Writer
+	userID   string
+	from, to time.Time
+	entries  int
+}
+
+func (j *jsonWriter) Opening(balance int) error {
+	userID, err := json.Marshal(j.userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(
+		j.w,
+		`{"user_id":%s,"from":%q,"to":%q,"opening_balance":%s,"items":[`,
+		userID,
+		j.from.Format(time.RFC3339),
+		j.to.Format(time.RFC3339),
+		amount(balance),
+	)
+
+	return err
+}
+
+func (j *jsonWriter) Entry(entry *bonus.LedgerEntry, balance int) error {
+	content, err := json.Marshal(jsonEntry{
+		Date:     entry.CreatedAt.Format(time.RFC3339),
+		Type:     entry.Type,
+		Order:    entry.OrderID,
+		Amount:   json.Number(amount(entry.Amount)),
+		Balance:  json.Number(amount(balance)),
+		Campaign: entry.CampaignID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if j.entries > 0 {
+		if err = j.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	j.entries++
+
+	_, err = j.w.Write(content)
+
+	return err
+}
+
+func (j *jsonWriter) Closing(balance int) error {
+	_, err := fmt.Fprintf(j.w, `],"closing_balance":%s}`, amount(balance))
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return j.w.Flush()
+}
@@ -0,0 +1,88 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeStatement(t *testing.T, format string) string {
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, "aaaa-bbbb-cccc-dddd", from, to)
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Opening(1000))
+	assert.NoError(t, w.Entry(&bonus.LedgerEntry{
+		Type:      bonus.LedgerAccrual,
+		OrderID:   "79927398713",
+		Amount:    50000,
+		CreatedAt: from.Add(time.Hour),
+	}, 51000))
+	assert.NoError(t, w.Entry(&bonus.LedgerEntry{
+		Type:      bonus.LedgerWithdrawal,
+		OrderID:   "2377225624",
+		Amount:    -15200,
+		CreatedAt: from.Add(2 * time.Hour),
+	}, 35800))
+	assert.NoError(t, w.Entry(&bonus.LedgerEntry{
+		Type:       bonus.LedgerBonus,
+		OrderID:    "79927398713",
+		CampaignID: "first-order",
+		Amount:     10000,
+		CreatedAt:  from.Add(3 * time.Hour),
+	}, 45800))
+	assert.NoError(t, w.Closing(45800))
+	assert.NoError(t, w.Flush())
+
+	return buf.String()
+}
+
+func TestCSVWriter(t *testing.T) {
+	expected := "date,type,order,amount,balance,campaign\n" +
+		"2023-01-01T00:00:00Z,opening_balance,,,10.00,\n" +
+		"2023-01-01T01:00:00Z,accrual,79927398713,500.00,510.00,\n" +
+		"2023-01-01T02:00:00Z,withdrawal,2377225624,-152.00,358.00,\n" +
+		"2023-01-01T03:00:00Z,bonus,79927398713,100.00,458.00,first-order\n" +
+		"2023-02-01T00:00:00Z,closing_balance,,,458.00,\n"
+
+	assert.Equal(t, expected, writeStatement(t, FormatCSV))
+}
+
+func TestJSONWriter(t *testing.T) {
+	content := writeStatement(t, FormatJSON)
+
+	var res struct {
+		UserID         string  `json:"user_id"`
+		OpeningBalance float64 `json:"opening_balance"`
+		Items          []struct {
+			Type     string  `json:"type"`
+			Order    string  `json:"order"`
+			Amount   float64 `json:"amount"`
+			Balance  float64 `json:"balance"`
+			Campaign string  `json:"campaign"`
+		} `json:"items"`
+		ClosingBalance float64 `json:"closing_balance"`
+	}
+
+	assert.NoError(t, json.Unmarshal([]byte(content), &res))
+	assert.Equal(t, "aaaa-bbbb-cccc-dddd", res.UserID)
+	assert.Equal(t, 10.0, res.OpeningBalance)
+	assert.Len(t, res.Items, 3)
+	assert.Equal(t, "2377225624", res.Items[1].Order)
+	assert.Equal(t, -152.0, res.Items[1].Amount)
+	assert.Empty(t, res.Items[1].Campaign)
+	assert.Equal(t, "first-order", res.Items[2].Campaign)
+	assert.Equal(t, 458.0, res.ClosingBalance)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewWriter("pdf", &bytes.Buffer{}, "", time.Now(), time.Now())
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
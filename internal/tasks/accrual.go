@@ -10,51 +10,88 @@ import (
 	"github.com/ruskiiamov/gophermart/internal/bonus"
 	"github.com/ruskiiamov/gophermart/internal/logger"
 	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
 )
 
-const retries = 3
+const (
+	AccrualType = "accrual"
+	retries     = 3
 
-type AccrualTask struct {
+	minProcessBackoff = 10 * time.Second
+	maxProcessBackoff = 10 * time.Minute
+)
+
+type accrualPayload struct {
+	tenantID string
+	orderID  string
+}
+
+func NewAccrualTask(tenantID string, orderID string) *queue.Task {
+	return queue.NewTask(AccrualType, &accrualPayload{tenantID: tenantID, orderID: orderID})
+}
+
+type AccrualHandler struct {
 	bonusManager *bonus.Manager
-	orderID      int
-	tries        int
 }
 
-func NewAccrualTask(bonusManager *bonus.Manager, orderID int) *AccrualTask {
-	return &AccrualTask{
-		bonusManager: bonusManager,
-		orderID:      orderID,
-	}
+func NewAccrualHandler(bonusManager *bonus.Manager) *AccrualHandler {
+	return &AccrualHandler{bonusManager: bonusManager}
 }
 
-func (a *AccrualTask) Handle() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (a *AccrualHandler) Handle(ctx context.Context, t *queue.Task) error {
+	payload, ok := t.Payload.(*accrualPayload)
+	if !ok {
+		return fmt.Errorf("wrong accrual task payload: %T", t.Payload)
+	}
+
+	ctx, cancel := context.WithTimeout(tenant.NewContext(ctx, payload.tenantID), 1*time.Second)
 	defer cancel()
 
-	err := a.bonusManager.SetOrderAccrual(ctx, a.orderID)
+	err := a.bonusManager.SetOrderAccrual(ctx, payload.orderID)
 	if err == nil {
 		return nil
 	}
 
+	if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("accrual task canceled: %w", err)
+	}
+
+	// polling an order that is not ready yet is not a failed attempt
 	if errors.Is(err, bonus.ErrAccrualNotReady) {
-		return &queue.ErrRetryAfter{}
+		return &queue.ErrRetryAfter{Poll: true}
 	}
 
 	var errNotAvailable *accrualsystem.ErrNotAvailable
 	if errors.As(err, &errNotAvailable) {
-		return &queue.ErrRetryAfter{Duration: time.Until(errNotAvailable.AvailableSince)}
+		return &queue.ErrRetryAfter{Duration: time.Until(errNotAvailable.AvailableSince), Poll: true}
 	}
 
 	logger.Error(fmt.Sprintf("set order accrual error: %s", err))
-	a.tries = a.tries + 1
-	if a.tries < retries {
+	if t.Attempt < retries {
 		return &queue.ErrRetryAfter{}
 	}
 
-	err = a.bonusManager.SetOrderInvalid(ctx, a.orderID)
+	// nothing of a processed order was written, it is retried with a growing
+	// backoff instead of being marked invalid
+	if errors.Is(err, bonus.ErrProcessFailed) {
+		return &queue.ErrRetryAfter{Duration: processBackoff(t.Attempt - retries)}
+	}
+
+	err = a.bonusManager.SetOrderInvalid(ctx, payload.orderID)
 	if err != nil {
 		logger.Error(fmt.Sprintf("set order invalid error: %s", err))
 	}
 
 	return nil
 }
+
+func processBackoff(attempt int) time.Duration {
+	d := minProcessBackoff
+	for i := 0; i < attempt && d < maxProcessBackoff; i++ {
+		d *= 2
+	}
+	if d > maxProcessBackoff {
+		return maxProcessBackoff
+	}
+	return d
+}
@@ -0,0 +1,51 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/logger"
+	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+)
+
+const HoldsType = "holds"
+
+type holdsPayload struct {
+	tenantID string
+}
+
+func NewHoldsTask(tenantID string) *queue.Task {
+	return queue.NewTask(HoldsType, &holdsPayload{tenantID: tenantID})
+}
+
+type HoldsHandler struct {
+	bonusManager *bonus.Manager
+}
+
+func NewHoldsHandler(bonusManager *bonus.Manager) *HoldsHandler {
+	return &HoldsHandler{bonusManager: bonusManager}
+}
+
+func (h *HoldsHandler) Handle(ctx context.Context, t *queue.Task) error {
+	payload, ok := t.Payload.(*holdsPayload)
+	if !ok {
+		return fmt.Errorf("wrong holds task payload: %T", t.Payload)
+	}
+
+	ctx, cancel := context.WithTimeout(tenant.NewContext(ctx, payload.tenantID), 1*time.Minute)
+	defer cancel()
+
+	count, err := h.bonusManager.ReleaseExpiredHolds(ctx)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		logger.Info(fmt.Sprintf("%d expired holds released for tenant %s", count, payload.tenantID))
+	}
+
+	return nil
+}
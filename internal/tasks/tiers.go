@@ -0,0 +1,49 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ruskiiamov/gophermart/internal/bonus"
+	"github.com/ruskiiamov/gophermart/internal/logger"
+	"github.com/ruskiiamov/gophermart/internal/queue"
+	"github.com/ruskiiamov/gophermart/internal/tenant"
+)
+
+const TiersType = "tiers"
+
+type tiersPayload struct {
+	tenantID string
+}
+
+func NewTiersTask(tenantID string) *queue.Task {
+	return queue.NewTask(TiersType, &tiersPayload{tenantID: tenantID})
+}
+
+type TiersHandler struct {
+	bonusManager *bonus.Manager
+}
+
+func NewTiersHandler(bonusManager *bonus.Manager) *TiersHandler {
+	return &TiersHandler{bonusManager: bonusManager}
+}
+
+func (h *TiersHandler) Handle(ctx context.Context, t *queue.Task) error {
+	payload, ok := t.Payload.(*tiersPayload)
+	if !ok {
+		return fmt.Errorf("wrong tiers task payload: %T", t.Payload)
+	}
+
+	ctx, cancel := context.WithTimeout(tenant.NewContext(ctx, payload.tenantID), 5*time.Minute)
+	defer cancel()
+
+	count, err := h.bonusManager.RecalculateTiers(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("tiers recalculated for %d users of tenant %s", count, payload.tenantID))
+
+	return nil
+}
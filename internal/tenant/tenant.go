@@ -0,0 +1,154 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultID = "default"
+	Header    = "X-Tenant-ID"
+)
+
+var (
+	ErrUnknown  = errors.New("unknown tenant")
+	ErrIDFormat = errors.New("wrong tenant id format")
+	ErrNoTenant = errors.New("no tenants configured")
+)
+
+var idRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type Tenant struct {
+	ID                   string   `json:"id"`
+	Hosts                []string `json:"hosts"`
+	AccrualSystemAddress string   `json:"accrual_system_address"`
+	SigningKeyFile       string   `json:"signing_key_file"`
+	SigningKeyID         string   `json:"signing_key_id"`
+	VerificationKeysDir  string   `json:"verification_keys_dir"`
+}
+
+type Registry struct {
+	tenants  map[string]*Tenant
+	hosts    map[string]*Tenant
+	fallback *Tenant
+}
+
+func NewRegistry(tenants ...*Tenant) (*Registry, error) {
+	if len(tenants) == 0 {
+		return nil, ErrNoTenant
+	}
+
+	r := &Registry{
+		tenants: make(map[string]*Tenant, len(tenants)),
+		hosts:   make(map[string]*Tenant),
+	}
+
+	for _, t := range tenants {
+		if !idRegexp.MatchString(t.ID) {
+			return nil, fmt.Errorf("%w: %q", ErrIDFormat, t.ID)
+		}
+		if _, ok := r.tenants[t.ID]; ok {
+			return nil, fmt.Errorf("duplicate tenant %q", t.ID)
+		}
+		r.tenants[t.ID] = t
+
+		for _, host := range t.Hosts {
+			host = normalizeHost(host)
+			if other, ok := r.hosts[host]; ok {
+				return nil, fmt.Errorf("host %q used by tenants %q and %q", host, other.ID, t.ID)
+			}
+			r.hosts[host] = t
+		}
+	}
+
+	if len(tenants) == 1 {
+		r.fallback = tenants[0]
+	}
+
+	return r, nil
+}
+
+func LoadRegistry(file string) (*Registry, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read tenants file error: %w", err)
+	}
+
+	var tenants []*Tenant
+	err = json.Unmarshal(content, &tenants)
+	if err != nil {
+		return nil, fmt.Errorf("parse tenants file error: %w", err)
+	}
+
+	return NewRegistry(tenants...)
+}
+
+func (r *Registry) Get(id string) (*Tenant, bool) {
+	t, ok := r.tenants[id]
+	return t, ok
+}
+
+func (r *Registry) Tenants() []*Tenant {
+	tenants := make([]*Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		tenants = append(tenants, t)
+	}
+
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+
+	return tenants
+}
+
+// Resolve prefers an explicit tenant header over the request host. A single
+// configured tenant serves any host.
+func (r *Registry) Resolve(header, host string) (*Tenant, error) {
+	if header != "" {
+		t, ok := r.tenants[header]
+		if !ok {
+			return nil, ErrUnknown
+		}
+		return t, nil
+	}
+
+	if t, ok := r.hosts[normalizeHost(host)]; ok {
+		return t, nil
+	}
+
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+
+	return nil, ErrUnknown
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	if !ok || id == "" {
+		return DefaultID
+	}
+
+	return id
+}
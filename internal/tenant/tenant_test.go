@@ -0,0 +1,69 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	registry, err := NewRegistry(
+		&Tenant{ID: "alpha", Hosts: []string{"alpha.example.com"}},
+		&Tenant{ID: "beta", Hosts: []string{"beta.example.com", "Shop.Beta.Example.com"}},
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header string
+		host   string
+		id     string
+		err    error
+	}{
+		{name: "host", host: "alpha.example.com", id: "alpha"},
+		{name: "host with port", host: "beta.example.com:8080", id: "beta"},
+		{name: "host case", host: "shop.beta.example.com", id: "beta"},
+		{name: "header", header: "beta", host: "alpha.example.com", id: "beta"},
+		{name: "unknown header", header: "gamma", host: "alpha.example.com", err: ErrUnknown},
+		{name: "unknown host", host: "localhost:8080", err: ErrUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tnt, err := registry.Resolve(tt.header, tt.host)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.Equal(t, tt.id, tnt.ID)
+			}
+		})
+	}
+}
+
+func TestResolveSingle(t *testing.T) {
+	registry, err := NewRegistry(&Tenant{ID: DefaultID})
+	assert.NoError(t, err)
+
+	tnt, err := registry.Resolve("", "localhost:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultID, tnt.ID)
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	_, err := NewRegistry()
+	assert.ErrorIs(t, err, ErrNoTenant)
+
+	_, err = NewRegistry(&Tenant{ID: "Bad Tenant"})
+	assert.ErrorIs(t, err, ErrIDFormat)
+
+	_, err = NewRegistry(&Tenant{ID: "a"}, &Tenant{ID: "a"})
+	assert.Error(t, err)
+
+	_, err = NewRegistry(&Tenant{ID: "a", Hosts: []string{"x"}}, &Tenant{ID: "b", Hosts: []string{"X"}})
+	assert.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, DefaultID, FromContext(context.Background()))
+	assert.Equal(t, "alpha", FromContext(NewContext(context.Background(), "alpha")))
+}
@@ -0,0 +1,126 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyPair(t *testing.T, dir, name string, modTime time.Time) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	certFile, keyFile := writeKeyPair(t, dir, "first", now.Add(-time.Minute))
+
+	r, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, cert))
+
+	t.Run("unchanged", func(t *testing.T) {
+		reloaded, err := r.Reload()
+		require.NoError(t, err)
+		assert.False(t, reloaded)
+	})
+
+	t.Run("broken files keep the old certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+
+		_, err := r.Reload()
+		assert.Error(t, err)
+
+		cert, err := r.GetCertificate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "first", commonName(t, cert))
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		writeKeyPair(t, dir, "second", now)
+
+		reloaded, err := r.Reload()
+		require.NoError(t, err)
+		assert.True(t, reloaded)
+
+		cert, err := r.GetCertificate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "second", commonName(t, cert))
+	})
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "server", time.Now())
+
+	r, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	t.Run("without client ca", func(t *testing.T) {
+		cfg, err := ServerConfig(r, "")
+		require.NoError(t, err)
+		assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+		assert.Contains(t, cfg.NextProtos, "h2")
+	})
+
+	t.Run("with client ca", func(t *testing.T) {
+		cfg, err := ServerConfig(r, certFile)
+		require.NoError(t, err)
+		assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+		assert.NotNil(t, cfg.ClientCAs)
+	})
+
+	t.Run("empty client ca", func(t *testing.T) {
+		empty := filepath.Join(dir, "empty.pem")
+		require.NoError(t, os.WriteFile(empty, nil, 0600))
+
+		_, err := ServerConfig(r, empty)
+		assert.ErrorIs(t, err, ErrClientCA)
+	})
+}